@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"strconv"
+	"strings"
 
 	"github.com/sbinet/go-svn2git/svn"
 )
@@ -16,11 +18,15 @@ var (
 	g_no_minimize_url = flag.Bool("no-minimize-url", false, "accept URLs as-is without attempting to connect a higher level directory")
 	g_root_is_trunk   = flag.Bool("root-is-trunk", false, "use this if the root level of the repo is equivalent to the trunk and there are no tags or branches")
 	g_rebase          = flag.Bool("rebase", false, "instead of cloning a new project, rebase an existing one against SVN")
+	g_bare            = flag.Bool("bare", false, "produce a bare repository, without checking out any branch")
+	g_trunk_branch    = flag.String("trunk-branch", "master", "name of the git branch trunk is converted into")
 	g_username        = flag.String("username", "", "username for transports that needs it (http(s), svn)")
 	g_trunk           = flag.String("trunk", "trunk", "subpath to trunk from repository URL")
 	g_branches        = flag.String("branches", "branches", "subpath to branches from repository URL")
 	g_tags            = flag.String("tags", "tags", "subpath to tags from repository URL")
-	g_exclude         = flag.String("exclude", "", "regular expression to filter paths when fetching")
+	g_subdir          = flag.String("subdir", "", "only convert this directory of trunk, branches and tags, as the root of the git repository")
+	g_exclude         flag_list
+	g_include         flag_list
 	g_revision        = flag.String("revision", "", "start importing from SVN revision START_REV; optionally end at END_REV. e.g. -revision START_REV:END_REV")
 
 	g_no_trunk    = flag.Bool("no-trunk", false, "do not import anything from trunk")
@@ -28,17 +34,105 @@ var (
 	g_no_tags     = flag.Bool("no-tags", false, "do not import anything from tags")
 	g_authors     = flag.String("authors", "$HOME/.config/go-svn2git/authors", "path to file containing svn-to-git authors mapping")
 
+	g_push_to      = flag.String("push-to", "", "push the converted branches and tags to the git remote at URL")
+	g_push_mirror  = flag.Bool("push-mirror", false, "push all refs with --mirror (incompatible with -push-refspec)")
+	g_push_refspec flag_list
+	g_report       flag_list
+
+	g_gitignore     = flag.Bool("gitignore", false, "convert svn:ignore and svn:global-ignores properties into .gitignore files")
+	g_gitattributes = flag.Bool("gitattributes", false, "convert svn:eol-style, svn:mime-type and svn:keywords properties into .gitattributes files")
+	g_svnprops      = flag.Bool("svnprops", false, "record the versioned properties no other option converts in a JSON file of each branch")
+	g_svnprops_file = flag.String("svnprops-file", ".svnprops", "name of the file recording the versioned properties (with -svnprops)")
+	g_externals     = flag.String("externals", "", "handle svn:externals: report, submodule, vendor or manifest")
+	g_externals_map = flag.String("externals-map", "", "path to file mapping SVN URLs to git URLs (for -externals submodule)")
+
+	g_lfs_threshold = flag.String("lfs-threshold", "", "move files larger than SIZE (e.g. 10M) to Git LFS")
+	g_lfs_pattern   flag_list
+
+	g_path_rule flag_list
+
+	g_mergeinfo     = flag.Bool("mergeinfo", false, "turn complete merges recorded in svn:mergeinfo into git merge commits")
+	g_svn_id        = flag.String("svn-id", "keep", "handle the git-svn-id lines of commit messages: keep, strip or trailer")
+	g_svn_id_format = flag.String("svn-id-format", "", "format of the trailers of '-svn-id trailer' ({rev}, {path}, {url}; default: \"SVN-Revision: r{rev}\\nSVN-Path: {path}\")")
+	g_prune_empty   = flag.Bool("prune-empty", false, "drop the commits without file changes (e.g. property-only or directory-only changes)")
+	g_modified_tags = flag.String("modified-tags", "tip", "handle tags committed to after their creation: tip, source or branch")
+	g_recreated     = flag.String("recreated", "keep", "handle previous incarnations (NAME@REV) of re-created branches and tags: keep, drop, archive or tag")
+
+	g_archive_deleted   = flag.Bool("archive-deleted", false, "import the branches and tags deleted from SVN under the archive namespace")
+	g_archive_namespace = flag.String("archive-namespace", "refs/archive/", "namespace of the archived deleted branches and tags")
+
+	g_log_encoding = flag.String("log-encoding", "", "convert the commit messages and authors which are not valid UTF-8 from this encoding: cp1252, latin1 or latin9")
+
+	g_committer      = flag.String("committer", "", "identity (\"Name <email>\") of the committers of the commits and annotated tags (default: the authors)")
+	g_committer_date = flag.String("committer-date", "svn", "date of the committers of the commits and annotated tags: svn (the SVN date) or now (the time of the migration)")
+
+	g_message_cleanup = flag.Bool("message-cleanup", false, "clean up commit messages: trailing whitespace, blank lines, \"*** empty log message ***\", cvs2svn artefacts")
+	g_empty_message   = flag.String("empty-message", "(no commit message)", "message replacing the empty ones with -message-cleanup")
+	g_message_rule    flag_list
+	g_message_filter  = flag.String("message-filter", "", "shell command filtering each commit message from stdin to stdout")
+
+	g_rev_refs        = flag.String("rev-refs", "", "rewrite the SVN revision references (r1234, revision 1234, r100:200) of commit messages into git commits: replace or append")
+	g_rev_ref_regex   flag_list
+	g_rewrite_dry_run = flag.Bool("rewrite-dry-run", false, "only print the changes of commit messages the history rewrite would make")
+
+	g_revmap    flag_list
+	g_svn_notes = flag.Bool("svn-notes", false, "record the SVN revision of each commit in git notes (refs/notes/svn)")
+
+	g_revprops_notes  = flag.Bool("revprops-notes", false, "record the non-standard SVN revision properties of each commit in git notes")
+	g_revprops_ref    = flag.String("revprops-ref", "refs/notes/svn-revprops", "notes ref of the SVN revision properties")
+	g_revprops_format = flag.String("revprops-format", "text", "format of the notes of the SVN revision properties: text or json")
+
+	g_verify_revisions = flag.Int("verify-revisions", 0, "number of historical trunk revisions to compare as well with 'verify'")
+
 	g_url = ""
 )
 
+func init() {
+	flag.Var(&g_exclude, "exclude", "do not convert the paths matching the pattern: regular expression, or glob with a glob: prefix (may be repeated)")
+	flag.Var(&g_include, "include", "only convert the paths matching the pattern: regular expression, or glob with a glob: prefix (may be repeated)")
+	flag.Var(&g_path_rule, "path-rule", "move the directory (or file) SRC to DST in every commit, with a SRC=DST rule (may be repeated)")
+	flag.Var(&g_report, "report", "write a migration report to FILE (.json or .md, may be repeated)")
+	flag.Var(&g_lfs_pattern, "lfs-pattern", "move files matching the glob pattern to Git LFS (may be repeated)")
+	flag.Var(&g_message_rule, "message-rule", "rewrite commit messages with a sed-like s/REGEX/REPLACEMENT/[im] rule (may be repeated)")
+	flag.Var(&g_rev_ref_regex, "rev-ref-regex", "regular expression of SVN revision references, each group matching a revision (may be repeated, replaces the defaults)")
+	flag.Var(&g_revmap, "revmap", "export the SVN revision to git commit mapping to FILE (.csv or .json, may be repeated); read by verify and lookup")
+	flag.Var(&g_push_refspec, "push-refspec", "refspec to push with -push-to (may be repeated, default: all branches and tags)")
+}
+
+// flag_list is a flag.Value collecting the values of a repeated flag
+type flag_list []string
+
+func (f *flag_list) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *flag_list) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
+
 func git_svn_usage() {
 	fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
 	fmt.Fprintf(os.Stderr, " %s [options] SVN_URL\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, " %s verify [options] SVN_URL\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, " %s lookup [options] rREV|COMMIT...\n", os.Args[0])
 	flag.PrintDefaults()
 }
 
 func main() {
-	flag.Parse()
+	// sub-commands take the same options as the conversion itself
+	subcmd := ""
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "verify", "lookup":
+			subcmd = os.Args[1]
+		}
+	}
+	if subcmd != "" {
+		flag.CommandLine.Parse(os.Args[2:])
+	} else {
+		flag.Parse()
+	}
 
 	if *g_help {
 		git_svn_usage()
@@ -56,7 +150,7 @@ func main() {
 		*g_trunk,
 		*g_branches,
 		*g_tags,
-		*g_exclude,
+		"", // -exclude patterns are set as ctx.Excludes
 		*g_revision,
 		*g_no_trunk,
 		*g_no_branches,
@@ -64,6 +158,61 @@ func main() {
 		*g_authors,
 		)
 
+	ctx.Bare = *g_bare
+	ctx.Subdir = *g_subdir
+	ctx.Excludes = g_exclude
+	ctx.Includes = g_include
+	ctx.TrunkBranch = *g_trunk_branch
+	ctx.PushRemote = *g_push_to
+	ctx.PushRefspecs = g_push_refspec
+	ctx.PushMirror = *g_push_mirror
+	ctx.VerifyRevisions = *g_verify_revisions
+	ctx.RevmapFiles = g_revmap
+	ctx.SvnNotes = *g_svn_notes
+	ctx.RevpropsNotes = *g_revprops_notes
+	ctx.RevpropsRef = *g_revprops_ref
+	ctx.RevpropsFormat = *g_revprops_format
+	ctx.GitIgnore = *g_gitignore
+	ctx.GitAttributes = *g_gitattributes
+	ctx.SvnProps = *g_svnprops
+	ctx.SvnPropsFile = *g_svnprops_file
+	ctx.Externals = *g_externals
+	ctx.ExternalsMap = *g_externals_map
+	ctx.LfsPatterns = g_lfs_pattern
+	ctx.PathRules = g_path_rule
+	ctx.Mergeinfo = *g_mergeinfo
+	ctx.PruneEmpty = *g_prune_empty
+	ctx.SvnId = *g_svn_id
+	ctx.SvnIdFormat = strings.Replace(*g_svn_id_format, `\n`, "\n", -1)
+	ctx.LogEncoding = *g_log_encoding
+	ctx.Committer = *g_committer
+	ctx.CommitterDate = *g_committer_date
+	ctx.MessageCleanup = *g_message_cleanup
+	ctx.EmptyMessage = *g_empty_message
+	ctx.MessageRules = g_message_rule
+	ctx.MessageFilter = *g_message_filter
+	ctx.RevRefs = *g_rev_refs
+	ctx.RevRefRegexps = g_rev_ref_regex
+	ctx.RewriteDryRun = *g_rewrite_dry_run
+	ctx.ModifiedTags = *g_modified_tags
+	ctx.Recreated = *g_recreated
+	ctx.ArchiveDeleted = *g_archive_deleted
+	ctx.ArchiveNamespace = *g_archive_namespace
+
+	if *g_lfs_threshold != "" {
+		size, err := parse_size(*g_lfs_threshold)
+		if err != nil {
+			fmt.Printf("** invalid '-lfs-threshold' value: %v\n", err)
+			os.Exit(1)
+		}
+		ctx.LfsThreshold = size
+	}
+
+	if ctx.TrunkBranch == "" {
+		fmt.Printf("** invalid empty '-trunk-branch' value\n")
+		os.Exit(1)
+	}
+
 	if ctx.RootIsTrunk {
 		ctx.Trunk = ""
 		ctx.Branches = ""
@@ -86,15 +235,46 @@ func main() {
 		fmt.Printf("==go-svn2git...\n")
 		fmt.Printf(" verbose:  %v\n", ctx.Verbose)
 		fmt.Printf(" rebase:   %v\n", ctx.Rebase)
+		fmt.Printf(" bare:     %v\n", ctx.Bare)
 		fmt.Printf(" username: %q\n", ctx.UserName)
 		fmt.Printf(" trunk:    %q\n", ctx.Trunk)
+		fmt.Printf(" trunk-branch: %q\n", ctx.TrunkBranch)
 		fmt.Printf(" branches: %q\n", ctx.Branches)
 		fmt.Printf(" tags:     %q\n", ctx.Tags)
 		fmt.Printf(" authors:  %q\n", ctx.Authors)
 		fmt.Printf(" root-is-trunk: %v\n", ctx.RootIsTrunk)
-		fmt.Printf(" exclude:  %q\n", ctx.Exclude)
+		fmt.Printf(" exclude:  %q\n", ctx.Excludes)
+		fmt.Printf(" include:  %q\n", ctx.Includes)
+		fmt.Printf(" push-to:  %q\n", ctx.PushRemote)
+	}
+
+	if subcmd == "verify" {
+		if flag.NArg() != 1 {
+			fmt.Printf("** \"%s verify\" takes exactly one SVN_URL argument\n", os.Args[0])
+			os.Exit(1)
+		}
+		ctx.Url = flag.Arg(0)
+		err := ctx.Verify()
+		if err != nil {
+			fmt.Printf("**error** %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if subcmd == "lookup" {
+		if flag.NArg() == 0 {
+			fmt.Printf("** \"%s lookup\" takes at least one SVN revision or git commit argument\n", os.Args[0])
+			os.Exit(1)
+		}
+		err := ctx.Lookup(flag.Args())
+		if err != nil {
+			fmt.Printf("**error** %v\n", err)
+			os.Exit(1)
+		}
+		return
 	}
-	
+
 	if ctx.Rebase {
 		if flag.NArg() > 0 {
 			fmt.Printf("** too many arguments\n")
@@ -125,13 +305,43 @@ func main() {
 		ctx.Url = flag.Arg(0)
 	}
 
-	err := ctx.Run()
+	report, err := ctx.Run()
 	if err != nil {
 		fmt.Printf("**error** %v\n", err)
+	}
+	for _, fname := range g_report {
+		err1 := report.Save(fname)
+		if err1 != nil {
+			fmt.Printf("**error** writing report %q: %v\n", fname, err1)
+			err = err1
+		}
+	}
+	if err != nil {
 		os.Exit(1)
 	}
 }
 
+// parse_size parses a size in bytes, with an optional k, M or G suffix
+func parse_size(s string) (int64, error) {
+	unit := int64(1)
+	switch {
+	case strings.HasSuffix(s, "k"), strings.HasSuffix(s, "K"):
+		unit = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		unit = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		unit = 1 << 30
+	}
+	if unit != 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * unit, nil
+}
+
 func verify_working_tree_is_clean() error {
 	cmd := exec.Command("git", "status", "--porcelain", "--untracked-files=no")
 	out, err := cmd.CombinedOutput()
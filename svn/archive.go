@@ -0,0 +1,263 @@
+package svn
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ReportArchived describes a deleted SVN branch or tag whose history was
+// archived
+type ReportArchived struct {
+	SvnPath string `json:"svn_path"`
+	Created int    `json:"created"` // revision the branch or tag was (last) created in
+	Deleted int    `json:"deleted"` // revision the branch or tag was deleted in
+	Ref     string `json:"ref"`     // git ref holding its history
+}
+
+// prefix of the git-svn remote branches of the deleted branches and tags
+// fetched for the archive (e.g. "svn-archive/tags/1.0")
+const g_archive_remote_refs = "svn-archive/"
+
+// svn_deleted describes a SVN branch or tag which does not exist anymore
+type svn_deleted struct {
+	Kind    string // "branches" or "tags"
+	Name    string // name of the branch or tag
+	Path    string // path relative to the repository URL (e.g. "branches/1.x")
+	Created int    // revision of its last creation
+	Deleted int    // revision of its deletion
+}
+
+// archive_deleted scans the SVN history for the branches and tags which
+// were deleted, and moves their history under ctx.ArchiveNamespace
+// (e.g. refs/archive/branches/1.x). Those git-svn did not fetch are
+// fetched first.
+func (ctx *Context) archive_deleted() error {
+	var err error = nil
+	if ctx.RootIsTrunk {
+		return err
+	}
+	ns := ctx.archive_namespace()
+	if !strings.HasPrefix(ns, "refs/") {
+		return fmt.Errorf("invalid '-archive-namespace' %q (must start with refs/)", ctx.ArchiveNamespace)
+	}
+
+	deleted, err := ctx.svn_deleted()
+	if err != nil {
+		return err
+	}
+
+	start := 0
+	if ctx.Revision != "" {
+		start, _ = strconv.Atoi(strings.Split(ctx.Revision, ":")[0])
+	}
+
+	for _, d := range deleted {
+		if d.Deleted-1 < start {
+			ctx.skip(d.Path, fmt.Sprintf("deleted in r%d, before the imported revisions", d.Deleted))
+			continue
+		}
+		local := "refs/heads/" + d.Name
+		remote := "refs/remotes/svn/" + d.Name
+		if d.Kind == "tags" {
+			local = "refs/tags/" + d.Name
+			remote = "refs/remotes/svn/tags/" + d.Name
+		}
+		target := ns + d.Kind + "/" + d.Name
+
+		switch {
+		case ctx.ref_exists(local):
+			// converted as a live branch or tag: move it
+			err = ctx.move_ref(local, target)
+		case ctx.ref_exists(remote):
+			err = ctx.move_ref(remote, target)
+		default:
+			err = ctx.fetch_deleted(d, target)
+		}
+		if err != nil {
+			return err
+		}
+
+		if ctx.Verbose {
+			fmt.Printf(":: archived deleted [%s] (r%d-r%d) as %s\n", d.Path, d.Created, d.Deleted-1, target)
+		}
+		ctx.report.Archived = append(ctx.report.Archived, ReportArchived{
+			SvnPath: d.Path,
+			Created: d.Created,
+			Deleted: d.Deleted,
+			Ref:     target,
+		})
+	}
+	return err
+}
+
+// archive_namespace returns ctx.ArchiveNamespace, with a trailing slash
+func (ctx *Context) archive_namespace() string {
+	ns := ctx.ArchiveNamespace
+	if !strings.HasSuffix(ns, "/") {
+		ns += "/"
+	}
+	return ns
+}
+
+// svn_deleted returns the branches and tags which were created and then
+// deleted in the SVN history (and not re-created since)
+func (ctx *Context) svn_deleted() ([]svn_deleted, error) {
+	out, err := ctx.svn_cmd("info", "--show-item", "repos-root-url", ctx.Url)
+	if err != nil {
+		return nil, err
+	}
+	root := strings.Trim(string(out), " \r\n")
+	base := ctx.svn_path(root, ctx.Url)
+
+	dirs := make(map[string]string) // repository path -> kind
+	if ctx.Branches != "" && !ctx.NoBranches {
+		dirs[path.Join(base, ctx.Branches)] = "branches"
+	}
+	if ctx.Tags != "" && !ctx.NoTags {
+		dirs[path.Join(base, ctx.Tags)] = "tags"
+	}
+	if len(dirs) == 0 {
+		return nil, nil
+	}
+
+	out, err = ctx.svn_cmd("log", "--xml", "-v", "-q", "-r", "1:HEAD", ctx.Url+"@HEAD")
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		Entries []struct {
+			Rev   int `xml:"revision,attr"`
+			Paths []struct {
+				Action string `xml:"action,attr"`
+				Path   string `xml:",chardata"`
+			} `xml:"paths>path"`
+		} `xml:"logentry"`
+	}
+	err = xml.Unmarshal(out, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse log of %s: %v", ctx.Url, err)
+	}
+
+	state := make(map[string]*svn_deleted) // repository path -> state
+	for _, e := range doc.Entries {
+		for _, p := range e.Paths {
+			kind, ok := dirs[path.Dir(p.Path)]
+			if !ok {
+				continue
+			}
+			d := state[p.Path]
+			if d == nil {
+				name := path.Base(p.Path)
+				d = &svn_deleted{
+					Kind: kind,
+					Name: name,
+					Path: strings.TrimPrefix(strings.TrimPrefix(p.Path, base), "/"),
+				}
+				state[p.Path] = d
+			}
+			switch p.Action {
+			case "A", "R":
+				d.Created = e.Rev
+				d.Deleted = 0
+			case "D":
+				d.Deleted = e.Rev
+			}
+		}
+	}
+
+	deleted := []svn_deleted{}
+	for _, d := range state {
+		if d.Deleted > 0 && d.Created > 0 {
+			deleted = append(deleted, *d)
+		}
+	}
+	sort.Sort(svn_deleted_list(deleted))
+	return deleted, nil
+}
+
+// fetch_deleted fetches the history of the deleted branch or tag d with an
+// additional git-svn remote, and stores it as ref
+func (ctx *Context) fetch_deleted(d svn_deleted, ref string) error {
+	var err error = nil
+	remote := "archive-" + d.Kind + "-" + strings.Replace(d.Name, "/", "-", -1)
+	fetched := "refs/remotes/" + g_archive_remote_refs + d.Kind + "/" + d.Name
+	spec := d.Path
+	if sub := ctx.subdir(); sub != "" {
+		spec += "/" + sub
+	}
+
+	cmds := [][]string{
+		{"git", "config", "--local", "svn-remote." + remote + ".url", ctx.Url},
+		{"git", "config", "--local", "svn-remote." + remote + ".fetch", spec + ":" + fetched},
+	}
+	for _, cmdargs := range cmds {
+		cmd := exec.Command(cmdargs[0], cmdargs[1:]...)
+		ctx.print_cmd(cmd)
+		ctx.debug_cmd(cmd)
+		err = cmd.Run()
+		if err != nil {
+			return err
+		}
+	}
+	err = ctx.set_path_filters(remote)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("git", "svn", "fetch", remote,
+		"-r", fmt.Sprintf("%d:%d", d.Created, d.Deleted-1),
+	)
+	if ctx.Verbose {
+		fmt.Printf(":: running %s\n", strings.Join(cmd.Args, " "))
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+	}
+	err = cmd.Run()
+	if err != nil {
+		return err
+	}
+	if !ctx.ref_exists(fetched) {
+		ctx.warn(fmt.Sprintf("%s: no history could be fetched for the deleted %s", d.Path, d.Kind))
+		return nil
+	}
+	return ctx.move_ref(fetched, ref)
+}
+
+// ref_exists returns whether the fully qualified ref exists
+func (ctx *Context) ref_exists(ref string) bool {
+	cmd := exec.Command("git", "show-ref", "-q", "--verify", ref)
+	return cmd.Run() == nil
+}
+
+// move_ref renames the fully qualified ref src into dst
+func (ctx *Context) move_ref(src, dst string) error {
+	var err error = nil
+	for _, cmdargs := range [][]string{
+		{"git", "update-ref", dst, src},
+		{"git", "update-ref", "-d", src},
+	} {
+		cmd := exec.Command(cmdargs[0], cmdargs[1:]...)
+		ctx.print_cmd(cmd)
+		ctx.debug_cmd(cmd)
+		err = cmd.Run()
+		if err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+type svn_deleted_list []svn_deleted
+
+func (p svn_deleted_list) Len() int           { return len(p) }
+func (p svn_deleted_list) Less(i, j int) bool { return p[i].Path < p[j].Path }
+func (p svn_deleted_list) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// EOF
@@ -0,0 +1,131 @@
+package svn
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// tree_file is a file added to a branch by commit_files
+type tree_file struct {
+	Mode    string // git file mode (100644, 100755, 120000 or 160000)
+	Content []byte // content of the file (unused if Object is set)
+	Object  string // git object name (blob, or commit for submodules)
+}
+
+// commit_files creates a new commit on top of the local branch, adding (or
+// replacing) the given files, indexed by path.
+// The working tree is not used, so this also works in bare repositories.
+// No commit is created if the files are already up-to-date.
+func (ctx *Context) commit_files(branch string, files map[string]tree_file, msg string) (bool, error) {
+	var err error = nil
+	ref := "refs/heads/" + branch
+
+	out, err := ctx.git_output("rev-parse", "--verify", "-q", ref)
+	if err != nil {
+		return false, err
+	}
+	parent := strings.Trim(string(out), " \r\n")
+
+	tmp, err := ioutil.TempDir("", "go-svn2git-index-")
+	if err != nil {
+		return false, err
+	}
+	defer os.RemoveAll(tmp)
+	env := append(os.Environ(), "GIT_INDEX_FILE="+filepath.Join(tmp, "index"))
+
+	git := func(stdin []byte, cmdargs ...string) (string, error) {
+		cmd := exec.Command("git", cmdargs...)
+		cmd.Env = env
+		if stdin != nil {
+			cmd.Stdin = bytes.NewReader(stdin)
+		}
+		ctx.print_cmd(cmd)
+		stderr := new(bytes.Buffer)
+		cmd.Stderr = stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("%s: %v (%s)", strings.Join(cmd.Args, " "), err,
+				strings.Trim(stderr.String(), " \r\n"))
+		}
+		return strings.Trim(string(out), " \r\n"), nil
+	}
+
+	_, err = git(nil, "read-tree", parent)
+	if err != nil {
+		return false, err
+	}
+
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		f := files[path]
+		obj := f.Object
+		if obj == "" {
+			obj, err = git(f.Content, "hash-object", "-w", "--stdin")
+			if err != nil {
+				return false, err
+			}
+		}
+		_, err = git(nil, "update-index", "--add", "--replace", "--cacheinfo",
+			fmt.Sprintf("%s,%s,%s", f.Mode, obj, path))
+		if err != nil {
+			return false, err
+		}
+	}
+
+	tree, err := git(nil, "write-tree")
+	if err != nil {
+		return false, err
+	}
+	ptree, err := git(nil, "rev-parse", parent+"^{tree}")
+	if err != nil {
+		return false, err
+	}
+	if tree == ptree {
+		// nothing new
+		return false, nil
+	}
+
+	commit, err := git([]byte(msg), "commit-tree", tree, "-p", parent)
+	if err != nil {
+		return false, err
+	}
+	_, err = git(nil, "update-ref", "-m", "go-svn2git: "+strings.SplitN(msg, "\n", 2)[0],
+		ref, commit, parent)
+	if err != nil {
+		return false, err
+	}
+
+	return true, ctx.refresh_worktree(branch)
+}
+
+// refresh_worktree updates the working tree if branch was modified behind
+// the back of git while checked out
+func (ctx *Context) refresh_worktree(branch string) error {
+	if ctx.Bare {
+		return nil
+	}
+	out, err := ctx.git_output("symbolic-ref", "-q", "HEAD")
+	if err != nil {
+		// detached HEAD
+		return nil
+	}
+	if strings.Trim(string(out), " \r\n") != "refs/heads/"+branch {
+		return nil
+	}
+	cmd := exec.Command("git", "reset", "-q", "--hard")
+	ctx.print_cmd(cmd)
+	ctx.debug_cmd(cmd)
+	return cmd.Run()
+}
+
+// EOF
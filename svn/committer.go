@@ -0,0 +1,83 @@
+package svn
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// dates of the committers of the commits and annotated tags
+const (
+	CommitterDateSvn = "svn" // the date of the SVN revision (as the author date)
+	CommitterDateNow = "now" // the time of the migration
+)
+
+var g_ident_re = regexp.MustCompile(`^\s*([^<>]*[^<>\s])\s*<([^<>]*)>\s*$`)
+
+// parse_ident parses a "Name <email>" identity
+func parse_ident(ident string) (string, string, error) {
+	m := g_ident_re.FindStringSubmatch(ident)
+	if m == nil {
+		return "", "", fmt.Errorf("invalid identity %q (want \"Name <email>\")", ident)
+	}
+	return m[1], m[2], nil
+}
+
+// committer_filter is a commit and tag filter replacing the identity and
+// the date of the committers and taggers, leaving the authors as they are
+type committer_filter struct {
+	ident string // "Name <email>" of the committers ("" to keep them)
+	when  string // "seconds tz" date of the commits ("" to keep them)
+}
+
+func (ctx *Context) new_committer_filter() (*committer_filter, error) {
+	f := &committer_filter{}
+	if ctx.Committer != "" {
+		name, email, err := parse_ident(ctx.Committer)
+		if err != nil {
+			return nil, fmt.Errorf("invalid '-committer': %v", err)
+		}
+		f.ident = name + " <" + email + ">"
+	}
+	switch ctx.CommitterDate {
+	case CommitterDateSvn:
+		// keep the dates set by git-svn
+	case CommitterDateNow:
+		now := time.Now()
+		f.when = fmt.Sprintf("%d %s", now.Unix(), now.Format("-0700"))
+	default:
+		return nil, fmt.Errorf("invalid '-committer-date' %q (want svn or now)", ctx.CommitterDate)
+	}
+	return f, nil
+}
+
+// apply rewrites a "Name <email> when tz" fast-export identity
+func (f *committer_filter) apply(ident string) string {
+	i := strings.LastIndex(ident, "> ")
+	if i < 0 {
+		return ident
+	}
+	who, when := ident[:i+1], ident[i+2:]
+	if f.ident != "" {
+		who = f.ident
+	}
+	if f.when != "" {
+		when = f.when
+	}
+	return who + " " + when
+}
+
+func (f *committer_filter) filter(c *fi_commit) error {
+	c.Committer = f.apply(c.Committer)
+	return nil
+}
+
+func (f *committer_filter) filter_tag(t *fi_tag) error {
+	if t.Tagger != "" {
+		t.Tagger = f.apply(t.Tagger)
+	}
+	return nil
+}
+
+// EOF
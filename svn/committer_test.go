@@ -0,0 +1,99 @@
+package svn
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestParseIdent(t *testing.T) {
+	for _, tc := range []struct {
+		ident string
+		name  string
+		email string
+		err   bool
+	}{
+		{ident: "Jane Doe <jane@example.com>", name: "Jane Doe", email: "jane@example.com"},
+		{ident: "  Jane Doe   <jane@example.com>  ", name: "Jane Doe", email: "jane@example.com"},
+		{ident: "bot <>", name: "bot", email: ""},
+		{ident: "Jane Doe", err: true},
+		{ident: "<jane@example.com>", err: true},
+		{ident: "Jane <a> <b>", err: true},
+		{ident: "Jane <jane@example.com", err: true},
+	} {
+		name, email, err := parse_ident(tc.ident)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%q: expected an error", tc.ident)
+			}
+			continue
+		}
+		if err != nil || name != tc.name || email != tc.email {
+			t.Errorf("%q: got (%q, %q, %v), want (%q, %q)", tc.ident, name, email, err, tc.name, tc.email)
+		}
+	}
+}
+
+func TestCommitterFilterApply(t *testing.T) {
+	const ident = "jdoe <jdoe@0bc5e1ab> 1234567890 +0000"
+	for _, tc := range []struct {
+		f    committer_filter
+		in   string
+		want string
+	}{
+		{committer_filter{}, ident, ident},
+		{committer_filter{ident: "Migration <svn2git@example.com>"}, ident, "Migration <svn2git@example.com> 1234567890 +0000"},
+		{committer_filter{when: "1700000000 +0200"}, ident, "jdoe <jdoe@0bc5e1ab> 1700000000 +0200"},
+		{committer_filter{ident: "M <m@x>", when: "1700000000 +0200"}, ident, "M <m@x> 1700000000 +0200"},
+		{committer_filter{ident: "M <m@x>"}, "odd <a> b <c> 1 +0000", "M <m@x> 1 +0000"},
+		{committer_filter{ident: "M <m@x>"}, "no date", "no date"},
+	} {
+		if got := tc.f.apply(tc.in); got != tc.want {
+			t.Errorf("%+v on %q: got %q, want %q", tc.f, tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestNewCommitterFilter(t *testing.T) {
+	ctx := NewContext("http://svn.example.com/repo")
+	f, err := ctx.new_committer_filter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.ident != "" || f.when != "" {
+		t.Errorf("defaults: got %+v, want an identity filter", f)
+	}
+
+	ctx.Committer = " Migration  <svn2git@example.com> "
+	ctx.CommitterDate = CommitterDateNow
+	f, err = ctx.new_committer_filter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.ident != "Migration <svn2git@example.com>" {
+		t.Errorf("ident: got %q", f.ident)
+	}
+	if !regexp.MustCompile(`^\d+ [+-]\d{4}$`).MatchString(f.when) {
+		t.Errorf("when: got %q", f.when)
+	}
+
+	tag := &fi_tag{Tagger: "jdoe <jdoe@0bc5e1ab> 1234567890 +0000"}
+	err = f.filter_tag(tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag.Tagger != f.ident+" "+f.when {
+		t.Errorf("tagger: got %q", tag.Tagger)
+	}
+
+	for _, bad := range []func(){
+		func() { ctx.Committer, ctx.CommitterDate = "nobody", CommitterDateSvn },
+		func() { ctx.Committer, ctx.CommitterDate = "", "yesterday" },
+	} {
+		bad()
+		if _, err := ctx.new_committer_filter(); err == nil {
+			t.Errorf("%q, %q: expected an error", ctx.Committer, ctx.CommitterDate)
+		}
+	}
+}
+
+// EOF
@@ -0,0 +1,189 @@
+package svn
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ReportEncoding lists the revisions whose commit message or author was
+// not valid UTF-8
+type ReportEncoding struct {
+	Encoding    string `json:"encoding"`    // encoding the invalid UTF-8 was decoded from
+	Transcoded  []int  `json:"transcoded"`  // revisions converted to UTF-8
+	Undecodable []int  `json:"undecodable"` // revisions with bytes invalid in Encoding as well (replaced by U+FFFD)
+}
+
+// charset maps the bytes 0x80-0xff of a single-byte encoding to runes
+// (utf8.RuneError for undefined bytes)
+type charset [128]rune
+
+// g_cp1252_80 holds the runes of the bytes 0x80-0x9f in Windows-1252
+var g_cp1252_80 = [32]rune{
+	'€', utf8.RuneError, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', utf8.RuneError, 'Ž', utf8.RuneError,
+	utf8.RuneError, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', utf8.RuneError, 'ž', 'Ÿ',
+}
+
+// g_latin9_diffs holds the differences of ISO-8859-15 with ISO-8859-1
+var g_latin9_diffs = map[byte]rune{
+	0xa4: '€', 0xa6: 'Š', 0xa8: 'š', 0xb4: 'Ž', 0xb8: 'ž', 0xbc: 'Œ', 0xbd: 'œ', 0xbe: 'Ÿ',
+}
+
+// new_charset returns the charset of the named encoding
+func new_charset(name string) (*charset, error) {
+	cs := &charset{}
+	for i := range cs {
+		cs[i] = rune(0x80 + i)
+	}
+	switch strings.ToLower(strings.Replace(name, "_", "-", -1)) {
+	case "latin1", "latin-1", "iso-8859-1", "iso8859-1":
+		// identity
+	case "cp1252", "windows-1252":
+		copy(cs[:32], g_cp1252_80[:])
+	case "latin9", "latin-9", "iso-8859-15", "iso8859-15":
+		for b, r := range g_latin9_diffs {
+			cs[b-0x80] = r
+		}
+	default:
+		return nil, fmt.Errorf("unsupported '-log-encoding' %q (want cp1252, latin1 or latin9)", name)
+	}
+	return cs, nil
+}
+
+// decode converts s to UTF-8 if it is not valid UTF-8 already. It returns
+// whether s was converted, and whether some bytes could not be decoded.
+func (cs *charset) decode(s []byte) ([]byte, bool, bool) {
+	if utf8.Valid(s) {
+		return s, false, false
+	}
+	bad := false
+	out := make([]byte, 0, len(s)+len(s)/4)
+	for _, b := range s {
+		if b < 0x80 {
+			out = append(out, b)
+			continue
+		}
+		r := cs[b-0x80]
+		if r == utf8.RuneError {
+			bad = true
+		}
+		out = append(out, string(r)...)
+	}
+	return out, true, bad
+}
+
+// encoding_filter is a commit and tag filter converting to UTF-8 the
+// messages and identities which are not valid UTF-8
+type encoding_filter struct {
+	ctx         *Context
+	cs          *charset
+	transcoded  map[int]bool
+	undecodable map[int]bool
+}
+
+func (ctx *Context) new_encoding_filter() (*encoding_filter, error) {
+	cs, err := new_charset(ctx.LogEncoding)
+	if err != nil {
+		return nil, err
+	}
+	return &encoding_filter{
+		ctx:         ctx,
+		cs:          cs,
+		transcoded:  make(map[int]bool),
+		undecodable: make(map[int]bool),
+	}, nil
+}
+
+func (f *encoding_filter) filter(c *fi_commit) error {
+	converted, bad := false, false
+	for _, field := range []*string{&c.Author, &c.Committer} {
+		s, ok, ko := f.cs.decode([]byte(*field))
+		*field = string(s)
+		converted = converted || ok
+		bad = bad || ko
+	}
+
+	// an explicit encoding of the message takes precedence over
+	// -log-encoding. Messages in other encodings are left as is.
+	cs := f.cs
+	if c.Encoding != "" {
+		var err error
+		cs, err = new_charset(c.Encoding)
+		if err != nil && strings.EqualFold(c.Encoding, "utf-8") {
+			cs, err = f.cs, nil
+		}
+		if err == nil {
+			c.Encoding = ""
+		}
+	}
+	if c.Encoding == "" {
+		msg, ok, ko := cs.decode(c.Msg)
+		c.Msg = msg
+		converted = converted || ok
+		bad = bad || ko
+	}
+
+	if !converted {
+		return nil
+	}
+	rev := 0
+	if e, ok := f.ctx.revs.commit(c.OrigID); ok {
+		rev = e.Rev
+	}
+	if f.ctx.Verbose {
+		fmt.Printf(":: r%d (%s): converted message and identities to UTF-8\n", rev, c.OrigID)
+	}
+	if bad {
+		f.ctx.warn(fmt.Sprintf("r%d (%s): some bytes are invalid in %s too", rev, c.OrigID, f.ctx.LogEncoding))
+	}
+	if rev == 0 {
+		return nil
+	}
+	if bad {
+		f.undecodable[rev] = true
+	} else {
+		f.transcoded[rev] = true
+	}
+	return nil
+}
+
+func (f *encoding_filter) filter_tag(t *fi_tag) error {
+	tagger, ok1, _ := f.cs.decode([]byte(t.Tagger))
+	msg, ok2, _ := f.cs.decode(t.Msg)
+	t.Tagger = string(tagger)
+	t.Msg = msg
+	if (ok1 || ok2) && f.ctx.Verbose {
+		fmt.Printf(":: tag %s: converted message and tagger to UTF-8\n", t.Name)
+	}
+	return nil
+}
+
+// report fills the encoding section of the report
+func (f *encoding_filter) report() {
+	r := &f.ctx.report.Encoding
+	r.Encoding = f.ctx.LogEncoding
+	for rev := range f.transcoded {
+		r.Transcoded = append(r.Transcoded, rev)
+	}
+	for rev := range f.undecodable {
+		r.Undecodable = append(r.Undecodable, rev)
+	}
+	sort.Ints(r.Transcoded)
+	sort.Ints(r.Undecodable)
+}
+
+// format_revisions formats revisions as "r3, r5" ("none" if empty)
+func format_revisions(revs []int) string {
+	if len(revs) == 0 {
+		return "none"
+	}
+	strs := make([]string, 0, len(revs))
+	for _, rev := range revs {
+		strs = append(strs, "r"+strconv.Itoa(rev))
+	}
+	return strings.Join(strs, ", ")
+}
+
+// EOF
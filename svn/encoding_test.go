@@ -0,0 +1,87 @@
+package svn
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCharsetDecode(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		in        string
+		want      string
+		converted bool
+		bad       bool
+	}{
+		{name: "cp1252", in: "caf\xe9 \x80 \x93x\x94", want: "café € “x”", converted: true},
+		{name: "windows-1252", in: "\x8a\x9f", want: "ŠŸ", converted: true},
+		{name: "cp1252", in: "a\x81b", want: "a�b", converted: true, bad: true},
+		{name: "latin1", in: "caf\xe9 \xa4", want: "café ¤", converted: true},
+		{name: "ISO_8859-1", in: "\x80", want: "\u0080", converted: true},
+		{name: "latin9", in: "caf\xe9 \xa4 \xbd", want: "café € œ", converted: true},
+		{name: "iso-8859-15", in: "\xa6\xa8", want: "Šš", converted: true},
+		{name: "cp1252", in: "café €", want: "café €"},
+		{name: "latin1", in: "plain ascii", want: "plain ascii"},
+	} {
+		cs, err := new_charset(tc.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, converted, bad := cs.decode([]byte(tc.in))
+		if string(out) != tc.want || converted != tc.converted || bad != tc.bad {
+			t.Errorf("%s: decode(%q): got (%q, %v, %v), want (%q, %v, %v)",
+				tc.name, tc.in, out, converted, bad, tc.want, tc.converted, tc.bad)
+		}
+	}
+
+	if _, err := new_charset("utf-16"); err == nil {
+		t.Errorf("utf-16: expected an error")
+	}
+}
+
+func TestEncodingFilter(t *testing.T) {
+	ctx := NewContext("http://svn.example.com/repo")
+	ctx.Verbose = false
+	ctx.report = ctx.new_report()
+	ctx.revs = new_revmap()
+	ctx.revs.add(rev_entry{Rev: 3, Ref: "svn/trunk", Commit: "c3"})
+	ctx.revs.add(rev_entry{Rev: 4, Ref: "svn/trunk", Commit: "c4"})
+	ctx.LogEncoding = "latin1"
+	f, err := ctx.new_encoding_filter()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c3 := &fi_commit{
+		OrigID:    "c3",
+		Author:    "Ren\xe9 <rene@example.com> 1 +0000",
+		Committer: "Ren\xe9 <rene@example.com> 1 +0000",
+		Msg:       []byte("d\xe9j\xe0 vu\n"),
+	}
+	c4 := &fi_commit{
+		OrigID:    "c4",
+		Author:    "a <a@example.com> 1 +0000",
+		Committer: "a <a@example.com> 1 +0000",
+		Encoding:  "windows-1252",
+		Msg:       []byte("\x93quoted\x94\n"),
+	}
+	for _, c := range []*fi_commit{c3, c4} {
+		err = f.filter(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c3.Author != "René <rene@example.com> 1 +0000" || string(c3.Msg) != "déjà vu\n" {
+		t.Errorf("r3: got %q, %q", c3.Author, c3.Msg)
+	}
+	if c4.Encoding != "" || string(c4.Msg) != "“quoted”\n" {
+		t.Errorf("r4: got %q, %q", c4.Encoding, c4.Msg)
+	}
+
+	f.report()
+	if got := ctx.report.Encoding.Transcoded; !reflect.DeepEqual(got, []int{3, 4}) {
+		t.Errorf("transcoded: got %v", got)
+	}
+}
+
+// EOF
@@ -0,0 +1,410 @@
+package svn
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// modes of handling of svn:externals
+const (
+	ExternalsReport    = "report"    // only report svn:externals
+	ExternalsSubmodule = "submodule" // convert svn:externals into git submodules
+	ExternalsVendor    = "vendor"    // commit a snapshot of svn:externals
+	ExternalsManifest  = "manifest"  // list svn:externals in a manifest file
+)
+
+// name of the file listing svn:externals in "manifest" mode
+const g_externals_manifest = ".svnexternals"
+
+// svn_external describes a svn:externals definition
+type svn_external struct {
+	Path string // path of the external, relative to the branch root
+	Url  string // absolute URL of the external
+	Rev  int    // pinned revision (0: HEAD)
+}
+
+// ReportExternal describes a svn:externals definition found on a branch
+type ReportExternal struct {
+	Branch   string `json:"branch"`
+	Path     string `json:"path"`
+	Url      string `json:"url"`
+	Revision int    `json:"revision,omitempty"`
+	Action   string `json:"action"` // what was done with it
+}
+
+// convert_externals detects the svn:externals of trunk and of each branch,
+// reports them and handles them according to ctx.Externals.
+func (ctx *Context) convert_externals() error {
+	switch ctx.Externals {
+	case ExternalsReport, ExternalsSubmodule, ExternalsVendor, ExternalsManifest:
+		// ok
+	default:
+		return fmt.Errorf("invalid '-externals' mode %q", ctx.Externals)
+	}
+
+	var mapping map[string]string = nil
+	if ctx.Externals == ExternalsSubmodule {
+		if ctx.ExternalsMap == "" {
+			return fmt.Errorf("'-externals %s' needs an '-externals-map' file", ExternalsSubmodule)
+		}
+		m, err := read_mapping_file(ctx.ExternalsMap)
+		if err != nil {
+			return err
+		}
+		mapping = m
+	}
+
+	branches, err := ctx.svn_branches()
+	if err != nil {
+		return err
+	}
+	pm, err := new_path_mapper(ctx.PathRules)
+	if err != nil {
+		return err
+	}
+
+	for _, b := range branches {
+		externals, err := ctx.svn_externals(ctx.svn_url(b.Ref), b.Rev)
+		if err != nil {
+			return fmt.Errorf("branch %s: %v", b.Name, err)
+		}
+		if len(externals) == 0 {
+			continue
+		}
+		err = ctx.handle_externals(b, externals, mapping, pm)
+		if err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// svn_externals returns the svn:externals defined in the tree of burl at
+// revision rev (0 for HEAD), sorted by path
+func (ctx *Context) svn_externals(burl string, rev int) ([]svn_external, error) {
+	props, err := ctx.svn_proplist(burl, rev, "svn:externals")
+	if err != nil {
+		return nil, err
+	}
+	if len(props) == 0 {
+		return nil, nil
+	}
+	out, err := ctx.svn_cmd("info", "--show-item", "repos-root-url", burl)
+	if err != nil {
+		return nil, err
+	}
+	root := strings.Trim(string(out), " \r\n")
+
+	externals := []svn_external{}
+	for dir, p := range props {
+		dirurl := burl
+		if dir != "" {
+			dirurl = burl + "/" + dir
+		}
+		exts, err := parse_externals(dir, dirurl, root, p["svn:externals"])
+		if err != nil {
+			return nil, err
+		}
+		externals = append(externals, exts...)
+	}
+	sort.Sort(svn_externals(externals))
+	return externals, nil
+}
+
+// handle_externals converts the externals of one branch.
+// The files are added at the paths of the externals in SVN, which the
+// history rewrite moves according to pm: .gitmodules and the manifest list
+// the moved paths.
+func (ctx *Context) handle_externals(b svn_branch, externals []svn_external, mapping map[string]string, pm *path_mapper) error {
+	var err error = nil
+	files := make(map[string]tree_file)
+	msg := ""
+	modules := new(bytes.Buffer)
+
+	for _, ext := range externals {
+		action := "reported"
+		switch ctx.Externals {
+		case ExternalsManifest:
+			action = "listed in " + g_externals_manifest
+
+		case ExternalsVendor:
+			n, err := ctx.vendor_external(ext, files)
+			if err != nil {
+				return err
+			}
+			action = fmt.Sprintf("vendored (%d files)", n)
+
+		case ExternalsSubmodule:
+			giturl := map_url(mapping, ext.Url)
+			if giturl == "" {
+				action = "skipped: no git URL mapping"
+				break
+			}
+			out, err := ctx.git_output("ls-remote", giturl, "HEAD")
+			if err != nil {
+				return err
+			}
+			fields := strings.Fields(string(out))
+			if len(fields) == 0 {
+				action = "skipped: no HEAD in " + giturl
+				break
+			}
+			files[ext.Path] = tree_file{Mode: "160000", Object: fields[0]}
+			np := pm.apply(ext.Path)
+			fmt.Fprintf(modules, "[submodule %q]\n\tpath = %s\n\turl = %s\n", np, np, giturl)
+			action = "submodule " + giturl
+			if ext.Rev > 0 {
+				action += fmt.Sprintf(" (pinned at r%d in svn, HEAD in git)", ext.Rev)
+			}
+		}
+
+		if ctx.Verbose {
+			fmt.Printf(":: [%s] external %s -> %s: %s\n", b.Name, ext.Path, ext.Url, action)
+		}
+		ctx.report.Externals = append(ctx.report.Externals, ReportExternal{
+			Branch:   b.Name,
+			Path:     ext.Path,
+			Url:      ext.Url,
+			Revision: ext.Rev,
+			Action:   action,
+		})
+	}
+
+	switch ctx.Externals {
+	case ExternalsManifest:
+		buf := new(bytes.Buffer)
+		fmt.Fprintf(buf, "# svn:externals of %s@%d\n# path\turl\trevision\n", ctx.svn_url(b.Ref), b.Rev)
+		for _, ext := range externals {
+			rev := "HEAD"
+			if ext.Rev > 0 {
+				rev = strconv.Itoa(ext.Rev)
+			}
+			fmt.Fprintf(buf, "%s\t%s\t%s\n", pm.apply(ext.Path), ext.Url, rev)
+		}
+		files[g_externals_manifest] = tree_file{Mode: "100644", Content: buf.Bytes()}
+		msg = "List svn:externals in " + g_externals_manifest + "\n"
+	case ExternalsVendor:
+		msg = "Vendor svn:externals snapshot\n"
+	case ExternalsSubmodule:
+		if modules.Len() == 0 {
+			break
+		}
+		content := modules.Bytes()
+		old, err := ctx.git_output("cat-file", "blob", "refs/heads/"+b.Name+":.gitmodules")
+		if err == nil && len(old) > 0 && !bytes.Contains(old, content) {
+			if !bytes.HasSuffix(old, []byte("\n")) {
+				old = append(old, '\n')
+			}
+			content = append(old, content...)
+		}
+		files[".gitmodules"] = tree_file{Mode: "100644", Content: content}
+		msg = "Convert svn:externals into git submodules\n"
+	}
+
+	if len(files) == 0 {
+		return err
+	}
+	_, err = ctx.commit_files(b.Name, files, msg)
+	return err
+}
+
+// vendor_external exports ext from SVN and adds its files under ext.Path.
+// It returns the number of files added.
+func (ctx *Context) vendor_external(ext svn_external, files map[string]tree_file) (int, error) {
+	tmp, err := ioutil.TempDir("", "go-svn2git-external-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(tmp)
+	dir := filepath.Join(tmp, "export")
+
+	peg := ext.Url + "@HEAD"
+	if ext.Rev > 0 {
+		peg = ext.Url + "@" + strconv.Itoa(ext.Rev)
+	}
+	_, err = ctx.svn_cmd("export", "-q", "--force", "--native-eol", "LF", peg, dir)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	err = filepath.Walk(dir, func(fname string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, fname)
+		if err != nil {
+			return err
+		}
+		f := tree_file{Mode: "100644"}
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(fname)
+			if err != nil {
+				return err
+			}
+			f = tree_file{Mode: "120000", Content: []byte(target)}
+		default:
+			f.Content, err = ioutil.ReadFile(fname)
+			if err != nil {
+				return err
+			}
+			if fi.Mode()&0111 != 0 {
+				f.Mode = "100755"
+			}
+		}
+		files[path.Join(ext.Path, filepath.ToSlash(rel))] = f
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// parse_externals parses the value of the svn:externals property set on the
+// directory dir (relative to the branch root), whose URL is dirurl.
+// root is the URL of the root of the SVN repository.
+// Both the pre-1.5 format ("path [-r REV] URL") and the current one
+// ("[-r REV] URL[@PEG] path") are supported.
+func parse_externals(dir, dirurl, root, value string) ([]svn_external, error) {
+	externals := []svn_external{}
+	scan := bufio.NewScanner(strings.NewReader(value))
+	for scan.Scan() {
+		line := strings.Trim(scan.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("invalid svn:externals line %q", line)
+		}
+
+		var ext svn_external
+		rev := ""
+		var words []string
+		for i := 0; i < len(fields); i++ {
+			switch {
+			case fields[i] == "-r" && i+1 < len(fields):
+				rev = fields[i+1]
+				i++
+			case strings.HasPrefix(fields[i], "-r"):
+				rev = fields[i][len("-r"):]
+			default:
+				words = append(words, fields[i])
+			}
+		}
+		if len(words) != 2 {
+			return nil, fmt.Errorf("invalid svn:externals line %q", line)
+		}
+		target, local := words[0], words[1]
+		if strings.Contains(local, "://") && !strings.Contains(target, "://") {
+			// old format
+			target, local = local, target
+		}
+
+		// URL@PEG
+		if i := strings.LastIndex(target, "@"); i > strings.LastIndex(target, "/") {
+			if peg, err := strconv.Atoi(target[i+1:]); err == nil {
+				target = target[:i]
+				if rev == "" {
+					rev = strconv.Itoa(peg)
+				}
+			}
+		}
+		if rev != "" {
+			n, err := strconv.Atoi(rev)
+			if err != nil {
+				return nil, fmt.Errorf("invalid revision in svn:externals line %q", line)
+			}
+			ext.Rev = n
+		}
+
+		abs, err := resolve_external_url(target, dirurl, root)
+		if err != nil {
+			return nil, fmt.Errorf("invalid URL in svn:externals line %q: %v", line, err)
+		}
+		ext.Url = abs
+		ext.Path = path.Join(dir, local)
+		externals = append(externals, ext)
+	}
+	return externals, scan.Err()
+}
+
+// resolve_external_url resolves the (possibly relative) URL of an external
+// defined on the directory dirurl, in the repository rooted at root
+func resolve_external_url(target, dirurl, root string) (string, error) {
+	base := dirurl
+	if strings.HasPrefix(target, "^/") {
+		base = root
+		target = target[len("^/"):]
+	}
+	// "../x", "//host/x" and "/x" follow the usual URL resolution rules
+	b, err := url.Parse(strings.TrimRight(base, "/") + "/")
+	if err != nil {
+		return "", err
+	}
+	t, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(b.ResolveReference(t).String(), "/"), nil
+}
+
+// read_mapping_file reads a file of "key = value" lines
+func read_mapping_file(fname string) (map[string]string, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	m := make(map[string]string)
+	scan := bufio.NewScanner(f)
+	for scan.Scan() {
+		line := strings.Trim(scan.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("%s: invalid line %q (want KEY = VALUE)", fname, line)
+		}
+		m[strings.Trim(line[:i], " \t")] = strings.Trim(line[i+1:], " \t")
+	}
+	return m, scan.Err()
+}
+
+// map_url returns the git URL of the SVN URL u, using the longest matching
+// SVN URL prefix of the mapping
+func map_url(mapping map[string]string, u string) string {
+	best, key := "", ""
+	for svnurl := range mapping {
+		// the SVN URLs of the mapping may end with a slash
+		prefix := strings.TrimRight(svnurl, "/")
+		if (u == prefix || strings.HasPrefix(u, prefix+"/")) && len(prefix) > len(best) {
+			best, key = prefix, svnurl
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return mapping[key]
+}
+
+type svn_externals []svn_external
+
+func (p svn_externals) Len() int           { return len(p) }
+func (p svn_externals) Less(i, j int) bool { return p[i].Path < p[j].Path }
+func (p svn_externals) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// EOF
@@ -0,0 +1,132 @@
+package svn
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseExternals(t *testing.T) {
+	const (
+		root   = "http://svn.example.com/repo"
+		dirurl = "http://svn.example.com/repo/trunk/src"
+	)
+	for _, tc := range []struct {
+		value string
+		want  []svn_external
+	}{
+		{
+			// current format, absolute URL
+			"http://svn.example.com/lib/trunk lib",
+			[]svn_external{{Path: "src/lib", Url: "http://svn.example.com/lib/trunk"}},
+		},
+		{
+			// pre-1.5 format, with a revision
+			"lib -r 12 http://svn.example.com/lib/trunk",
+			[]svn_external{{Path: "src/lib", Url: "http://svn.example.com/lib/trunk", Rev: 12}},
+		},
+		{
+			// peg revision, relative to the repository root
+			"^/vendor/zlib@34 third_party/zlib",
+			[]svn_external{{Path: "src/third_party/zlib", Url: "http://svn.example.com/repo/vendor/zlib", Rev: 34}},
+		},
+		{
+			// -rREV takes precedence over the peg revision
+			"-r5 ../doc@7 doc\n# comment\n\n",
+			[]svn_external{{Path: "src/doc", Url: "http://svn.example.com/repo/trunk/doc", Rev: 5}},
+		},
+		{
+			"//svn.example.com/other/x x\n/abs/y y",
+			[]svn_external{
+				{Path: "src/x", Url: "http://svn.example.com/other/x"},
+				{Path: "src/y", Url: "http://svn.example.com/abs/y"},
+			},
+		},
+	} {
+		got, err := parse_externals("src", dirurl, root, tc.value)
+		if err != nil {
+			t.Errorf("parse_externals(%q): %v", tc.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("parse_externals(%q):\ngot  %+v\nwant %+v", tc.value, got, tc.want)
+		}
+	}
+
+	for _, value := range []string{"lib", "-r x http://svn.example.com/lib lib", "a b c"} {
+		if _, err := parse_externals("", dirurl, root, value); err == nil {
+			t.Errorf("parse_externals(%q): expected an error", value)
+		}
+	}
+}
+
+func TestMapUrl(t *testing.T) {
+	mapping := map[string]string{
+		"http://svn.example.com/lib/":           "https://git.example.com/lib.git",
+		"http://svn.example.com/lib/trunk/zlib": "https://git.example.com/zlib.git",
+		"http://svn.example.com/tools":          "https://git.example.com/tools.git",
+	}
+	for _, tc := range []struct {
+		url  string
+		want string
+	}{
+		{"http://svn.example.com/lib", "https://git.example.com/lib.git"},
+		{"http://svn.example.com/lib/trunk", "https://git.example.com/lib.git"},
+		{"http://svn.example.com/lib/trunk/zlib/src", "https://git.example.com/zlib.git"},
+		{"http://svn.example.com/tools", "https://git.example.com/tools.git"},
+		{"http://svn.example.com/toolset", ""},
+		{"http://svn.example.com/other", ""},
+	} {
+		if got := map_url(mapping, tc.url); got != tc.want {
+			t.Errorf("map_url(%q): got %q, want %q", tc.url, got, tc.want)
+		}
+	}
+}
+
+func TestHandleExternalsPathRules(t *testing.T) {
+	ctx := new_test_repo(t)
+	commit_file(t, "a.txt", "a\n", "first")
+	b := svn_branch{Name: "master", Ref: "svn/trunk", Rev: 5}
+	externals := []svn_external{
+		{Path: "doc/ext", Url: "http://svn.example.com/doc/trunk"},
+		{Path: "src/lib", Url: "http://svn.example.com/lib/trunk", Rev: 3},
+	}
+	pm, err := new_path_mapper([]string{"src=source"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx.Externals = ExternalsManifest
+	err = ctx.handle_externals(b, externals, nil, pm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# svn:externals of http://svn.example.com/repo/trunk@5
+# path	url	revision
+doc/ext	http://svn.example.com/doc/trunk	HEAD
+source/lib	http://svn.example.com/lib/trunk	3`
+	if got := run_git(t, "cat-file", "blob", "master:"+g_externals_manifest); got != want {
+		t.Errorf("manifest:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+
+	// the submodule of src/lib is hosted in a local repository
+	lib := t.TempDir()
+	run_git(t, "init", "-q", lib)
+	run_git(t, "-C", lib, "commit", "-q", "--allow-empty", "-m", "lib")
+	head := run_git(t, "-C", lib, "rev-parse", "HEAD")
+
+	ctx.Externals = ExternalsSubmodule
+	err = ctx.handle_externals(b, externals[1:], map[string]string{"http://svn.example.com/lib/trunk": lib}, pm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "[submodule \"source/lib\"]\n\tpath = source/lib\n\turl = " + lib
+	if got := run_git(t, "cat-file", "blob", "master:.gitmodules"); got != want {
+		t.Errorf(".gitmodules:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+	// the gitlink is moved by the history rewrite
+	if got := run_git(t, "rev-parse", "master:src/lib"); got != head {
+		t.Errorf("src/lib: got %s, want %s", got, head)
+	}
+}
+
+// EOF
@@ -0,0 +1,170 @@
+package svn
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// convert_attributes generates, for each converted branch, a .gitattributes
+// file equivalent to the svn:eol-style, svn:mime-type and svn:keywords
+// properties, added by a final commit on top of the branch.
+// The patterns match the paths of the files once moved by -path-rule.
+// It also checks that files with svn:executable (and only those) are
+// executable in git.
+func (ctx *Context) convert_attributes() error {
+	branches, err := ctx.svn_branches()
+	if err != nil {
+		return err
+	}
+	pm, err := new_path_mapper(ctx.PathRules)
+	if err != nil {
+		return err
+	}
+
+	for _, b := range branches {
+		url := ctx.svn_url(b.Ref)
+		props := make(svn_props)
+		for _, name := range []string{"svn:eol-style", "svn:mime-type", "svn:keywords", "svn:executable"} {
+			p, err := ctx.svn_proplist(url, b.Rev, name)
+			if err != nil {
+				return err
+			}
+			for path, values := range p {
+				if props[path] == nil {
+					props[path] = make(map[string]string)
+				}
+				for k, v := range values {
+					props[path][k] = v
+				}
+			}
+		}
+
+		err = ctx.check_executables(b, props)
+		if err != nil {
+			return err
+		}
+
+		content := ctx.gitattributes(b, props, pm)
+		if len(content) == 0 {
+			continue
+		}
+		old, err := ctx.git_output("cat-file", "blob", "refs/heads/"+b.Name+":.gitattributes")
+		if err == nil && len(old) > 0 {
+			if bytes.Contains(old, content) {
+				continue
+			}
+			if !bytes.HasSuffix(old, []byte("\n")) {
+				old = append(old, '\n')
+			}
+			content = append(old, content...)
+		}
+
+		ok, err := ctx.commit_files(b.Name,
+			map[string]tree_file{
+				".gitattributes": {Mode: "100644", Content: content},
+			},
+			"Convert svn:eol-style, svn:mime-type and svn:keywords to .gitattributes\n",
+		)
+		if err != nil {
+			return err
+		}
+		if ok && ctx.Verbose {
+			fmt.Printf(":: added .gitattributes to [%s]\n", b.Name)
+		}
+	}
+	return err
+}
+
+// gitattributes returns the .gitattributes lines equivalent to props, for
+// the paths rewritten by pm
+func (ctx *Context) gitattributes(b svn_branch, props svn_props, pm *path_mapper) []byte {
+	moved := make(map[string]string, len(props)) // new path -> svn path
+	paths := make([]string, 0, len(props))
+	for path := range props {
+		np := pm.apply(path)
+		moved[np] = path
+		paths = append(paths, np)
+	}
+	sort.Strings(paths)
+
+	buf := new(bytes.Buffer)
+	for _, np := range paths {
+		path := moved[np]
+		p := props[path]
+		attrs := []string{}
+
+		mime := p["svn:mime-type"]
+		binary := mime != "" && !strings.HasPrefix(mime, "text/")
+		if binary {
+			attrs = append(attrs, "binary")
+		}
+
+		switch eol := strings.Trim(p["svn:eol-style"], " \r\n"); eol {
+		case "":
+			// no conversion
+		case "native":
+			attrs = append(attrs, "text")
+		case "LF":
+			attrs = append(attrs, "text", "eol=lf")
+		case "CRLF":
+			attrs = append(attrs, "text", "eol=crlf")
+		default:
+			ctx.warn(fmt.Sprintf("[%s] %s: svn:eol-style %q has no git equivalent", b.Name, path, eol))
+		}
+
+		// git has no keyword expansion (but for $Id$, with another
+		// meaning): keep the information as a custom attribute.
+		if kw := strings.Fields(p["svn:keywords"]); len(kw) > 0 {
+			attrs = append(attrs, "svn-keywords="+strings.Join(kw, ","))
+		}
+
+		if len(attrs) == 0 {
+			continue
+		}
+		fmt.Fprintf(buf, "%s %s\n", gitattributes_pattern(np), strings.Join(attrs, " "))
+	}
+	return buf.Bytes()
+}
+
+// check_executables reports files whose git mode does not match their
+// svn:executable property
+func (ctx *Context) check_executables(b svn_branch, props svn_props) error {
+	tree, err := ctx.git_tree("refs/heads/" + b.Name)
+	if err != nil {
+		return err
+	}
+	for path, e := range tree {
+		_, exe := props[path]["svn:executable"]
+		switch {
+		case exe && e.Mode != "100755":
+			ctx.warn(fmt.Sprintf("[%s] %s: svn:executable is set but git mode is %s", b.Name, path, e.Mode))
+		case !exe && e.Mode == "100755":
+			ctx.warn(fmt.Sprintf("[%s] %s: executable in git but svn:executable is not set", b.Name, path))
+		}
+	}
+	return nil
+}
+
+// gitattributes_pattern returns the .gitattributes pattern matching exactly
+// the file at path (relative to the root of the repository)
+func gitattributes_pattern(path string) string {
+	// escape glob characters
+	var p []byte
+	for _, c := range []byte(path) {
+		switch c {
+		case '*', '?', '[', '\\':
+			p = append(p, '\\')
+		}
+		p = append(p, c)
+	}
+	pattern := "/" + string(p)
+	if strings.ContainsAny(pattern, " \t\"") {
+		pattern = strconv.Quote(pattern)
+	}
+	return pattern
+}
+
+// EOF
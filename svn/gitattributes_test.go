@@ -0,0 +1,83 @@
+package svn
+
+import (
+	"testing"
+)
+
+func TestGitattributes(t *testing.T) {
+	ctx := NewContext("http://svn.example.com/repo")
+	ctx.Verbose = false
+	ctx.report = ctx.new_report()
+
+	props := svn_props{
+		"":            {"svn:ignore": "*.o"},
+		"a.sh":        {"svn:eol-style": "LF", "svn:executable": "*"},
+		"doc/x.txt":   {"svn:eol-style": "native", "svn:keywords": "Id  Rev"},
+		"img/a b.png": {"svn:mime-type": "image/png"},
+		"w[1].bat":    {"svn:eol-style": "CRLF", "svn:mime-type": "text/plain"},
+		"odd.txt":     {"svn:eol-style": "CR"},
+	}
+	pm, err := new_path_mapper(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(ctx.gitattributes(svn_branch{Name: "master"}, props, pm))
+	want := `/a.sh text eol=lf
+/doc/x.txt text svn-keywords=Id,Rev
+"/img/a b.png" binary
+/w\[1].bat text eol=crlf
+`
+	if got != want {
+		t.Errorf("gitattributes:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+	if len(ctx.report.Warnings) != 1 {
+		t.Errorf("expected a warning for svn:eol-style CR, got %v", ctx.report.Warnings)
+	}
+}
+
+func TestGitattributesPathRules(t *testing.T) {
+	ctx := NewContext("http://svn.example.com/repo")
+	ctx.Verbose = false
+	ctx.report = ctx.new_report()
+
+	props := svn_props{
+		"a.sh":       {"svn:eol-style": "LF"},
+		"doc/x.txt":  {"svn:eol-style": "native"},
+		"src/y.c":    {"svn:eol-style": "native"},
+		"src/bin/z":  {"svn:mime-type": "application/octet-stream"},
+		"vendor/b.c": {"svn:eol-style": "native"},
+	}
+	pm, err := new_path_mapper([]string{"src=lib", "src/bin=bin", "doc=docs/manual"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(ctx.gitattributes(svn_branch{Name: "master"}, props, pm))
+	want := `/a.sh text eol=lf
+/bin/z binary
+/docs/manual/x.txt text
+/lib/y.c text
+/vendor/b.c text
+`
+	if got != want {
+		t.Errorf("gitattributes:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestGitattributesPattern(t *testing.T) {
+	for _, tc := range []struct {
+		path string
+		want string
+	}{
+		{"a.txt", "/a.txt"},
+		{"dir/*.c", `/dir/\*.c`},
+		{"q?.txt", `/q\?.txt`},
+		{`back\slash`, `/back\\slash`},
+		{"with space", `"/with space"`},
+	} {
+		if got := gitattributes_pattern(tc.path); got != tc.want {
+			t.Errorf("gitattributes_pattern(%q): got %q, want %q", tc.path, got, tc.want)
+		}
+	}
+}
+
+// EOF
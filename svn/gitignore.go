@@ -0,0 +1,99 @@
+package svn
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// convert_ignores converts the svn:ignore and svn:global-ignores properties
+// of each converted branch into .gitignore files, added by a final commit
+// on top of the branch.
+func (ctx *Context) convert_ignores() error {
+	branches, err := ctx.svn_branches()
+	if err != nil {
+		return err
+	}
+
+	for _, b := range branches {
+		url := ctx.svn_url(b.Ref)
+		ignores, err := ctx.svn_proplist(url, b.Rev, "svn:ignore")
+		if err != nil {
+			return err
+		}
+		globals, err := ctx.svn_proplist(url, b.Rev, "svn:global-ignores")
+		if err != nil {
+			return err
+		}
+
+		files := make(map[string]tree_file)
+		for dir, content := range gitignore_files(ignores, globals) {
+			path := ".gitignore"
+			if dir != "" {
+				path = dir + "/.gitignore"
+			}
+			// keep what was already committed
+			old, err := ctx.git_output("cat-file", "blob", "refs/heads/"+b.Name+":"+path)
+			if err == nil && len(old) > 0 {
+				if bytes.Contains(old, content) {
+					continue
+				}
+				if !bytes.HasSuffix(old, []byte("\n")) {
+					old = append(old, '\n')
+				}
+				content = append(old, content...)
+			}
+			files[path] = tree_file{Mode: "100644", Content: content}
+		}
+		if len(files) == 0 {
+			continue
+		}
+
+		ok, err := ctx.commit_files(b.Name, files,
+			"Convert svn:ignore properties to .gitignore files\n")
+		if err != nil {
+			return err
+		}
+		if ok && ctx.Verbose {
+			fmt.Printf(":: added %d .gitignore file(s) to [%s]\n", len(files), b.Name)
+		}
+	}
+	return err
+}
+
+// gitignore_files returns the content of the .gitignore files equivalent to
+// the svn:ignore and svn:global-ignores properties, indexed by directory.
+// svn:ignore patterns only apply to the direct children of a directory and
+// are thus anchored, while svn:global-ignores patterns apply recursively.
+func gitignore_files(ignores, globals svn_props) map[string][]byte {
+	files := make(map[string][]byte)
+	add := func(props svn_props, name, prefix string) {
+		dirs := make([]string, 0, len(props))
+		for dir := range props {
+			dirs = append(dirs, dir)
+		}
+		sort.Strings(dirs)
+		for _, dir := range dirs {
+			buf := files[dir]
+			for _, pattern := range strings.Split(props[dir][name], "\n") {
+				pattern = strings.Trim(pattern, " \t\r")
+				if pattern == "" {
+					continue
+				}
+				if prefix == "" && (strings.HasPrefix(pattern, "#") || strings.HasPrefix(pattern, "!")) {
+					pattern = `\` + pattern
+				}
+				buf = append(buf, prefix+pattern+"\n"...)
+			}
+			if len(buf) > 0 {
+				files[dir] = buf
+			}
+		}
+	}
+	add(ignores, "svn:ignore", "/")
+	add(globals, "svn:global-ignores", "")
+	return files
+}
+
+// EOF
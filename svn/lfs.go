@@ -0,0 +1,335 @@
+package svn
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// g_lfs_pointer_re matches the Git LFS pointer files written by pointer
+var g_lfs_pointer_re = regexp.MustCompile(`^version https://git-lfs\.github\.com/spec/v1\noid sha256:([0-9a-f]{64})\nsize ([0-9]+)\n$`)
+
+// ReportLfs summarizes the files moved to Git LFS
+type ReportLfs struct {
+	Objects int   `json:"objects"` // number of distinct LFS objects
+	Bytes   int64 `json:"bytes"`   // total size of the LFS objects
+}
+
+// git_catfile reads objects through a long-running 'git cat-file --batch'
+type git_catfile struct {
+	cmd *exec.Cmd
+	w   io.WriteCloser
+	r   *bufio.Reader
+}
+
+func (ctx *Context) new_git_catfile() (*git_catfile, error) {
+	cmd := exec.Command("git", "cat-file", "--batch")
+	ctx.print_cmd(cmd)
+	cmd.Stderr = os.Stderr
+	w, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	r, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+	return &git_catfile{cmd: cmd, w: w, r: bufio.NewReader(r)}, nil
+}
+
+// open requests an object and returns its size and a reader for its
+// content, which must be fully read before the next request.
+// A negative size is returned for missing objects.
+func (cf *git_catfile) open(name string) (int64, io.Reader, error) {
+	_, err := fmt.Fprintf(cf.w, "%s\n", name)
+	if err != nil {
+		return 0, nil, err
+	}
+	hdr, err := cf.r.ReadString('\n')
+	if err != nil {
+		return 0, nil, err
+	}
+	// <sha1> SP <type> SP <size> LF, or <name> SP missing LF
+	fields := strings.Fields(hdr)
+	if len(fields) != 3 {
+		return -1, nil, nil
+	}
+	size, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("cat-file: invalid header %q", hdr)
+	}
+	return size, &catfile_reader{r: io.LimitReader(cf.r, size), cf: cf}, nil
+}
+
+// read returns the content of an object (nil if missing)
+func (cf *git_catfile) read(name string) ([]byte, error) {
+	size, r, err := cf.open(name)
+	if err != nil || size < 0 {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+func (cf *git_catfile) close() error {
+	cf.w.Close()
+	return cf.cmd.Wait()
+}
+
+// catfile_reader consumes the LF following an object once it is fully read
+type catfile_reader struct {
+	r    io.Reader
+	cf   *git_catfile
+	done bool
+}
+
+func (r *catfile_reader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err == io.EOF && !r.done {
+		r.done = true
+		r.cf.r.ReadByte()
+	}
+	return n, err
+}
+
+// lfs_filter is a commit filter replacing the content of large or matching
+// files by Git LFS pointers
+type lfs_filter struct {
+	ctx      *Context
+	cat      *git_catfile
+	dir      string                     // $GIT_DIR/lfs/objects
+	dry_run  bool                       // do not write the LFS objects
+	pointers map[string][]byte          // blob SHA-1 -> LFS pointer
+	small    map[string]bool            // blobs smaller than the size threshold
+	paths    map[string]map[string]bool // mark -> paths converted because of their size, in the history of the commit
+	attrs    map[string]string          // mark -> .gitattributes content of the commit
+	base     map[string][]byte          // mark -> original .gitattributes content
+}
+
+func (ctx *Context) new_lfs_filter() (*lfs_filter, error) {
+	for _, pattern := range ctx.LfsPatterns {
+		_, err := path.Match(pattern, "")
+		if err != nil {
+			return nil, fmt.Errorf("invalid LFS pattern %q: %v", pattern, err)
+		}
+	}
+	cat, err := ctx.new_git_catfile()
+	if err != nil {
+		return nil, err
+	}
+	return &lfs_filter{
+		ctx:      ctx,
+		cat:      cat,
+		dir:      filepath.Join(ctx.git_dir(), "lfs", "objects"),
+		dry_run:  ctx.RewriteDryRun,
+		pointers: make(map[string][]byte),
+		small:    make(map[string]bool),
+		paths:    make(map[string]map[string]bool),
+		attrs:    make(map[string]string),
+		base:     make(map[string][]byte),
+	}, nil
+}
+
+func (lfs *lfs_filter) close() error {
+	return lfs.cat.close()
+}
+
+// match returns whether path matches one of the LFS patterns.
+// As for .gitattributes, patterns without a slash match file names.
+func (lfs *lfs_filter) match(p string) bool {
+	for _, pattern := range lfs.ctx.LfsPatterns {
+		name := p
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(p)
+		}
+		if ok, _ := path.Match(strings.TrimPrefix(pattern, "/"), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (lfs *lfs_filter) filter(c *fi_commit) error {
+	// the paths converted because of their size are inherited from the
+	// first parent: each branch lists its own
+	paths := lfs.paths[c.From]
+	touched := false
+	files := c.Files[:0:0]
+	for _, f := range c.Files {
+		switch {
+		case f.Op == 0 || f.Path == ".gitattributes" || f.Dest == ".gitattributes":
+			touched = true
+		case f.Op == 'M' && (f.Mode == "100644" || f.Mode == "100755") && f.Data != "inline":
+			matched := lfs.match(f.Path)
+			ptr, err := lfs.pointer(f.Data, matched)
+			if err != nil {
+				return err
+			}
+			if ptr != nil {
+				if !matched && !paths[f.Path] {
+					inherited := paths
+					paths = make(map[string]bool, len(inherited)+1)
+					for p := range inherited {
+						paths[p] = true
+					}
+					paths[f.Path] = true
+				}
+				f.Data = "inline"
+				f.Blob = ptr
+			}
+		}
+		files = append(files, f)
+	}
+
+	// original .gitattributes, inherited from the first parent unless
+	// modified by this commit
+	base := lfs.base[c.From]
+	if touched {
+		var err error
+		base, err = lfs.cat.read(c.OrigID + ":.gitattributes")
+		if err != nil {
+			return err
+		}
+	}
+	lfs.base[c.Mark] = base
+	lfs.paths[c.Mark] = paths
+
+	content := string(base) + lfs.attributes(paths)
+	if content != lfs.attrs[c.From] || (touched && content != string(base)) {
+		// drop the original change of .gitattributes, if any
+		kept := files[:0]
+		for _, f := range files {
+			if f.Op == 'M' && f.Path == ".gitattributes" {
+				continue
+			}
+			kept = append(kept, f)
+		}
+		files = append(kept, fi_file{
+			Op:   'M',
+			Mode: "100644",
+			Data: "inline",
+			Blob: []byte(content),
+			Path: ".gitattributes",
+		})
+	}
+	lfs.attrs[c.Mark] = content
+	c.Files = files
+	return nil
+}
+
+// attributes returns the .gitattributes lines routing files to LFS: those
+// of the patterns, and those of the paths converted because of their size
+func (lfs *lfs_filter) attributes(converted map[string]bool) string {
+	const attrs = " filter=lfs diff=lfs merge=lfs -text\n"
+	lines := []string{}
+	for _, pattern := range lfs.ctx.LfsPatterns {
+		lines = append(lines, pattern+attrs)
+	}
+	paths := make([]string, 0, len(converted))
+	for p := range converted {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		lines = append(lines, gitattributes_pattern(p)+attrs)
+	}
+	return strings.Join(lines, "")
+}
+
+// pointer stores the blob in the LFS object store and returns its LFS
+// pointer, if it matched or is larger than the size threshold.
+// Nothing is stored in dry runs.
+func (lfs *lfs_filter) pointer(blob string, matched bool) ([]byte, error) {
+	if ptr, ok := lfs.pointers[blob]; ok {
+		return ptr, nil
+	}
+	if lfs.small[blob] && !matched {
+		return nil, nil
+	}
+	size, r, err := lfs.cat.open(blob)
+	if err != nil {
+		return nil, err
+	}
+	if size < 0 {
+		return nil, fmt.Errorf("lfs: missing blob %s", blob)
+	}
+	threshold := lfs.ctx.LfsThreshold
+	if !matched && (threshold <= 0 || size < threshold) {
+		_, err = io.Copy(ioutil.Discard, r)
+		lfs.small[blob] = true
+		return nil, err
+	}
+
+	h := sha256.New()
+	var tmp *os.File
+	if lfs.dry_run {
+		_, err = io.Copy(h, r)
+	} else {
+		err = os.MkdirAll(lfs.dir, 0755)
+		if err != nil {
+			return nil, err
+		}
+		tmp, err = ioutil.TempFile(lfs.dir, "incomplete-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(tmp.Name())
+		_, err = io.Copy(io.MultiWriter(tmp, h), r)
+		tmp.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	oid := hex.EncodeToString(h.Sum(nil))
+	dst := filepath.Join(lfs.dir, oid[0:2], oid[2:4], oid)
+	if !path_exists(dst) {
+		if !lfs.dry_run {
+			err = os.MkdirAll(filepath.Dir(dst), 0755)
+			if err != nil {
+				return nil, err
+			}
+			err = os.Rename(tmp.Name(), dst)
+			if err != nil {
+				return nil, err
+			}
+		}
+		lfs.ctx.report.Lfs.Objects++
+		lfs.ctx.report.Lfs.Bytes += size
+	}
+
+	ptr := new(bytes.Buffer)
+	fmt.Fprintf(ptr, "version https://git-lfs.github.com/spec/v1\noid sha256:%s\nsize %d\n", oid, size)
+	lfs.pointers[blob] = ptr.Bytes()
+	return ptr.Bytes(), nil
+}
+
+// parse_lfs_pointer returns the SHA-256 and the size of the object of a
+// Git LFS pointer file, and whether content is one
+func parse_lfs_pointer(content []byte) (string, int64, bool) {
+	m := g_lfs_pointer_re.FindSubmatch(content)
+	if m == nil {
+		return "", 0, false
+	}
+	size, err := strconv.ParseInt(string(m[2]), 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return string(m[1]), size, true
+}
+
+// EOF
@@ -0,0 +1,99 @@
+package svn
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// new_lfs_repo returns a Context for a repository whose master and "other"
+// branches each add a large file
+func new_lfs_repo(t *testing.T) *Context {
+	ctx := new_test_repo(t)
+	ctx.LfsThreshold = 100
+	commit_file(t, "small.txt", "small\n", "r1")
+	run_git(t, "branch", "other")
+	commit_file(t, "a.bin", strings.Repeat("a", 200), "r2")
+	run_git(t, "checkout", "-q", "other")
+	commit_file(t, "b.bin", strings.Repeat("b", 200), "r3")
+	run_git(t, "checkout", "-q", "master")
+	return ctx
+}
+
+func TestLfsPathsPerBranch(t *testing.T) {
+	ctx := new_lfs_repo(t)
+	err := ctx.rewrite_history()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		branch string
+		want   string
+	}{
+		{"master", "/a.bin filter=lfs diff=lfs merge=lfs -text\n"},
+		{"other", "/b.bin filter=lfs diff=lfs merge=lfs -text\n"},
+	} {
+		got := run_git(t, "cat-file", "blob", tc.branch+":.gitattributes") + "\n"
+		if got != tc.want {
+			t.Errorf("[%s] .gitattributes: got %q, want %q", tc.branch, got, tc.want)
+		}
+	}
+	ptr := run_git(t, "cat-file", "blob", "other:b.bin")
+	if !strings.HasPrefix(ptr, "version https://git-lfs.github.com/spec/v1\n") {
+		t.Errorf("other:b.bin is not a LFS pointer: %q", ptr)
+	}
+	if ctx.report.Lfs.Objects != 2 || ctx.report.Lfs.Bytes != 400 {
+		t.Errorf("report: got %+v, want 2 objects of 400 bytes", ctx.report.Lfs)
+	}
+	objects := filepath.Join(ctx.git_dir(), "lfs", "objects")
+	n := 0
+	filepath.Walk(objects, func(path string, fi os.FileInfo, err error) error {
+		if err == nil && !fi.IsDir() {
+			n++
+		}
+		return nil
+	})
+	if n != 2 {
+		t.Errorf("%s: got %d objects, want 2", objects, n)
+	}
+}
+
+func TestLfsDryRun(t *testing.T) {
+	ctx := new_lfs_repo(t)
+	head := run_git(t, "rev-parse", "master")
+	ctx.RewriteDryRun = true
+	err := ctx.rewrite_history()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := run_git(t, "rev-parse", "master"); got != head {
+		t.Errorf("dry run rewrote master")
+	}
+	objects := filepath.Join(ctx.git_dir(), "lfs")
+	if _, err := os.Stat(objects); !os.IsNotExist(err) {
+		t.Errorf("dry run wrote LFS objects in %s", objects)
+	}
+}
+
+func TestParseLfsPointer(t *testing.T) {
+	const oid = "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393"
+	for _, tc := range []struct {
+		content string
+		ok      bool
+	}{
+		{"version https://git-lfs.github.com/spec/v1\noid sha256:" + oid + "\nsize 12345\n", true},
+		{"version https://git-lfs.github.com/spec/v1\noid sha256:" + oid + "\nsize 12345", false},
+		{"version https://git-lfs.github.com/spec/v1\noid sha1:" + oid[:40] + "\nsize 12345\n", false},
+		{"oid sha256:" + oid + "\nsize 12345\n", false},
+		{"plain text\n", false},
+	} {
+		got, size, ok := parse_lfs_pointer([]byte(tc.content))
+		if ok != tc.ok || (ok && (got != oid || size != 12345)) {
+			t.Errorf("%q: got (%q, %d, %v)", tc.content, got, size, ok)
+		}
+	}
+}
+
+// EOF
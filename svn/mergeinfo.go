@@ -0,0 +1,411 @@
+package svn
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ReportMerge describes a SVN merge found in the svn:mergeinfo of a branch
+type ReportMerge struct {
+	Branch    string `json:"branch"`
+	Revision  int    `json:"revision"`  // SVN revision of the merge
+	Source    string `json:"source"`    // SVN path of the merge source
+	Revisions string `json:"revisions"` // merged revisions
+	Action    string `json:"action"`    // what was done with it
+}
+
+// rev_range is a range of revisions of a svn:mergeinfo value
+type rev_range struct {
+	Start, End     int  // first and last revisions (inclusive)
+	NonInheritable bool // the range only applies to the directory itself ("*")
+}
+
+// parse_mergeinfo parses a svn:mergeinfo value: one "/path:1-5,7*,9" line
+// per merge source
+func parse_mergeinfo(value string) (map[string][]rev_range, error) {
+	info := make(map[string][]rev_range)
+	scan := bufio.NewScanner(strings.NewReader(value))
+	for scan.Scan() {
+		line := strings.Trim(scan.Text(), " \t\r")
+		if line == "" {
+			continue
+		}
+		i := strings.LastIndex(line, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid svn:mergeinfo line %q", line)
+		}
+		src := line[:i]
+		for _, tok := range strings.Split(line[i+1:], ",") {
+			r := rev_range{}
+			tok = strings.Trim(tok, " ")
+			if strings.HasSuffix(tok, "*") {
+				r.NonInheritable = true
+				tok = tok[:len(tok)-1]
+			}
+			bounds := strings.SplitN(tok, "-", 2)
+			var err error
+			r.Start, err = strconv.Atoi(bounds[0])
+			if err != nil {
+				return nil, fmt.Errorf("invalid svn:mergeinfo line %q", line)
+			}
+			r.End = r.Start
+			if len(bounds) == 2 {
+				r.End, err = strconv.Atoi(bounds[1])
+				if err != nil {
+					return nil, fmt.Errorf("invalid svn:mergeinfo line %q", line)
+				}
+			}
+			info[src] = append(info[src], r)
+		}
+	}
+	return info, scan.Err()
+}
+
+// subtract_ranges returns the revisions of a which are not in b
+func subtract_ranges(a, b []rev_range) []rev_range {
+	out := []rev_range{}
+	for _, r := range a {
+		parts := []rev_range{r}
+		for _, o := range b {
+			next := []rev_range{}
+			for _, p := range parts {
+				if o.End < p.Start || o.Start > p.End {
+					next = append(next, p)
+					continue
+				}
+				if o.Start > p.Start {
+					next = append(next, rev_range{p.Start, o.Start - 1, p.NonInheritable})
+				}
+				if o.End < p.End {
+					next = append(next, rev_range{o.End + 1, p.End, p.NonInheritable})
+				}
+			}
+			parts = next
+		}
+		out = append(out, parts...)
+	}
+	return out
+}
+
+// format_ranges formats revision ranges as "r3-5,r9"
+func format_ranges(ranges []rev_range) string {
+	strs := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		s := "r" + strconv.Itoa(r.Start)
+		if r.End != r.Start {
+			s += "-" + strconv.Itoa(r.End)
+		}
+		if r.NonInheritable {
+			s += "*"
+		}
+		strs = append(strs, s)
+	}
+	return strings.Join(strs, ",")
+}
+
+// svn_merge is a SVN merge represented by a git merge commit
+type svn_merge struct {
+	Commit string // original git commit of the merge revision
+	Parent string // original git commit of the merged source revision
+	Report int    // index of the merge in the report
+}
+
+// merge_filter is a commit filter adding the merged sources as parents of
+// the commits of merge revisions
+type merge_filter struct {
+	ctx    *Context
+	rw     *rewriter
+	merges map[string][]svn_merge // original commit -> merges
+}
+
+// new_merge_filter finds, on each converted branch, the revisions changing
+// the svn:mergeinfo of the branch root, and checks whether they merged
+// another branch completely.
+// With -subdir, the merges are still those of the branch roots (where SVN
+// records the merges of whole branches).
+// Merges of some revisions only (cherry-picks), of subdirectories, and
+// reverse merges can not be represented in git: they are only reported.
+func (ctx *Context) new_merge_filter(rw *rewriter) (*merge_filter, error) {
+	mf := &merge_filter{
+		ctx:    ctx,
+		rw:     rw,
+		merges: make(map[string][]svn_merge),
+	}
+
+	out, err := ctx.svn_cmd("info", "--show-item", "repos-root-url", ctx.Url)
+	if err != nil {
+		return nil, err
+	}
+	root := strings.Trim(string(out), " \r\n")
+
+	// SVN path of the branch root -> git-svn ref
+	refs := make(map[string]string)
+	for ref := range ctx.revs.refs {
+		refs[ctx.svn_path(root, ctx.svn_branch_url(ref))] = ref
+	}
+
+	branches, err := ctx.svn_branches()
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range branches {
+		err = mf.collect(b, root, refs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return mf, nil
+}
+
+// collect finds the merges of the branch b
+func (mf *merge_filter) collect(b svn_branch, root string, refs map[string]string) error {
+	ctx := mf.ctx
+	entries := ctx.revs.refs[b.Ref]
+	first := entries[0].Rev
+	if first >= b.Rev {
+		return nil
+	}
+	burl := ctx.svn_branch_url(b.Ref)
+	bpath := ctx.svn_path(root, burl)
+	commits := make(map[int]string, len(entries))
+	for _, e := range entries {
+		commits[e.Rev] = e.Commit
+	}
+
+	revs, err := ctx.svn_prop_changes(burl, bpath, first+1, b.Rev)
+	if err != nil {
+		return err
+	}
+	if len(revs) == 0 {
+		return nil
+	}
+
+	prev, err := ctx.svn_mergeinfo(burl, first)
+	if err != nil {
+		return err
+	}
+	for _, rev := range revs {
+		cur, err := ctx.svn_mergeinfo(burl, rev)
+		if err != nil {
+			return err
+		}
+		srcs := make([]string, 0, len(cur))
+		for src := range cur {
+			srcs = append(srcs, src)
+		}
+		sort.Strings(srcs)
+		for _, src := range srcs {
+			added := subtract_ranges(cur[src], prev[src])
+			if len(added) == 0 {
+				continue
+			}
+			m := ReportMerge{
+				Branch:    b.Name,
+				Revision:  rev,
+				Source:    src,
+				Revisions: format_ranges(added),
+			}
+			parent, action, err := mf.merge_parent(burl, rev, src, added, refs)
+			if err != nil {
+				return err
+			}
+			m.Action = action
+			commit, ok := commits[rev]
+			if parent != "" && !ok {
+				parent, m.Action = "", "not represented: no git commit for the merge revision"
+			}
+			if parent != "" {
+				mf.merges[commit] = append(mf.merges[commit], svn_merge{
+					Commit: commit,
+					Parent: parent,
+					Report: len(ctx.report.Merges),
+				})
+			}
+			if ctx.Verbose {
+				fmt.Printf(":: [%s] r%d merged %s %s: %s\n", b.Name, rev, src, m.Revisions, m.Action)
+			}
+			ctx.report.Merges = append(ctx.report.Merges, m)
+		}
+		removed_srcs := make([]string, 0, len(prev))
+		for src := range prev {
+			removed_srcs = append(removed_srcs, src)
+		}
+		sort.Strings(removed_srcs)
+		for _, src := range removed_srcs {
+			if removed := subtract_ranges(prev[src], cur[src]); len(removed) > 0 {
+				ctx.report.Merges = append(ctx.report.Merges, ReportMerge{
+					Branch:    b.Name,
+					Revision:  rev,
+					Source:    src,
+					Revisions: format_ranges(removed),
+					Action:    "not represented: reverse merge",
+				})
+			}
+		}
+		prev = cur
+	}
+	return nil
+}
+
+// merge_parent returns the original git commit to use as the parent
+// representing the merge of the revisions added of src into burl@rev, or
+// the reason why the merge can not be represented.
+func (mf *merge_filter) merge_parent(burl string, rev int, src string, added []rev_range, refs map[string]string) (string, string, error) {
+	ctx := mf.ctx
+	last := 0
+	for _, r := range added {
+		if r.NonInheritable {
+			return "", "not represented: non-inheritable (partial) merge", nil
+		}
+		if r.End > last {
+			last = r.End
+		}
+	}
+	ref, ok := refs[src]
+	if !ok {
+		return "", "not represented: source is not a converted branch", nil
+	}
+
+	// a complete merge leaves no eligible revision up to the last merged one
+	out, err := ctx.svn_cmd("mergeinfo", "--show-revs", "eligible",
+		ctx.svn_branch_url(ref)+"@"+strconv.Itoa(last), burl+"@"+strconv.Itoa(rev))
+	if err != nil {
+		return "", "", err
+	}
+	missing := []rev_range{}
+	for _, line := range strings.Fields(string(out)) {
+		n, err := strconv.Atoi(strings.TrimRight(strings.TrimPrefix(line, "r"), "*"))
+		if err == nil && n <= last {
+			missing = append(missing, rev_range{Start: n, End: n})
+		}
+	}
+	if len(missing) > 0 {
+		return "", "not represented: cherry-pick (" + format_ranges(missing) + " not merged)", nil
+	}
+
+	parent := ""
+	for _, e := range ctx.revs.refs[ref] {
+		if e.Rev > last {
+			break
+		}
+		parent = e.Commit
+	}
+	if parent == "" {
+		return "", fmt.Sprintf("not represented: no git commit for %s@%d", src, last), nil
+	}
+	return parent, fmt.Sprintf("merge commit (parent: %s@%d)", strings.TrimPrefix(ref, "svn/"), last), nil
+}
+
+// filter adds the merged sources of c as parents. A merged source not
+// rewritten yet is either outside of the converted branches and tags (the
+// merge is then only reported), or later in the history: this happens when
+// the dates of the SVN revisions are out of order, and is an error, as the
+// rewritten merge would have a parent in the original history.
+func (mf *merge_filter) filter(c *fi_commit) error {
+	for _, m := range mf.merges[c.OrigID] {
+		r := &mf.ctx.report.Merges[m.Report]
+		parent := mf.rw.commit_ref(m.Parent)
+		switch {
+		case parent == "":
+			r.Action = "not represented: merged commit was dropped"
+		case parent == m.Parent:
+			patterns := []string{"refs/heads/", "refs/tags/"}
+			if mf.ctx.ArchiveDeleted {
+				patterns = append(patterns, mf.ctx.archive_namespace())
+			}
+			args := append([]string{"for-each-ref", "--count=1", "--format=%(refname)", "--contains", m.Parent}, patterns...)
+			out, err := mf.ctx.git_output(args...)
+			if err != nil {
+				return err
+			}
+			if len(bytes.TrimSpace(out)) > 0 {
+				return fmt.Errorf("mergeinfo: commit %s (r%d) merges commit %s, which is rewritten later: "+
+					"the dates of the SVN revisions are out of order", c.OrigID, r.Revision, m.Parent)
+			}
+			r.Action = "not represented: merged commit is not on a converted branch or tag"
+		case parent == c.From || is_in_slice(parent, c.Merges):
+			r.Action = "already a merge commit"
+		default:
+			c.Merges = append(c.Merges, parent)
+		}
+	}
+	return nil
+}
+
+// svn_path returns the path of svnurl in the repository rooted at root
+// (e.g. "/branches/1.x")
+func (ctx *Context) svn_path(root, svnurl string) string {
+	p := strings.TrimPrefix(svnurl, strings.TrimRight(root, "/"))
+	if u, err := url.PathUnescape(p); err == nil {
+		p = u
+	}
+	return "/" + strings.Trim(p, "/")
+}
+
+// svn_prop_changes returns the revisions, between first and last, changing
+// the properties of the directory at svnurl, whose path is path
+func (ctx *Context) svn_prop_changes(svnurl, path string, first, last int) ([]int, error) {
+	out, err := ctx.svn_cmd("log", "--xml", "-v", "-q",
+		"-r", fmt.Sprintf("%d:%d", first, last),
+		svnurl+"@"+strconv.Itoa(last),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		Entries []struct {
+			Rev   int `xml:"revision,attr"`
+			Paths []struct {
+				PropMods string `xml:"prop-mods,attr"`
+				Path     string `xml:",chardata"`
+			} `xml:"paths>path"`
+		} `xml:"logentry"`
+	}
+	err = xml.Unmarshal(out, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse log of %s: %v", svnurl, err)
+	}
+	revs := []int{}
+	for _, e := range doc.Entries {
+		for _, p := range e.Paths {
+			if p.PropMods == "true" && p.Path == path {
+				revs = append(revs, e.Rev)
+				break
+			}
+		}
+	}
+	sort.Ints(revs)
+	return revs, nil
+}
+
+// svn_mergeinfo returns the svn:mergeinfo of the directory svnurl@rev
+func (ctx *Context) svn_mergeinfo(svnurl string, rev int) (map[string][]rev_range, error) {
+	out, err := ctx.svn_cmd("proplist", "-v", "--xml", svnurl+"@"+strconv.Itoa(rev))
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		Props []struct {
+			Name  string `xml:"name,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"target>property"`
+	}
+	err = xml.Unmarshal(out, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse properties of %s@%d: %v", svnurl, rev, err)
+	}
+	for _, p := range doc.Props {
+		if p.Name == "svn:mergeinfo" {
+			return parse_mergeinfo(p.Value)
+		}
+	}
+	return map[string][]rev_range{}, nil
+}
+
+// EOF
@@ -0,0 +1,142 @@
+package svn
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMergeinfo(t *testing.T) {
+	got, err := parse_mergeinfo("/trunk:1-5,7*,9\n\n/branches/1.x:12\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]rev_range{
+		"/trunk":        {{1, 5, false}, {7, 7, true}, {9, 9, false}},
+		"/branches/1.x": {{12, 12, false}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parse_mergeinfo: got %v, want %v", got, want)
+	}
+	if got := format_ranges(want["/trunk"]); got != "r1-5,r7*,r9" {
+		t.Errorf("format_ranges: got %q", got)
+	}
+
+	for _, value := range []string{"/trunk", "/trunk:x", "/trunk:1-y"} {
+		if _, err := parse_mergeinfo(value); err == nil {
+			t.Errorf("parse_mergeinfo(%q): expected an error", value)
+		}
+	}
+}
+
+func TestSubtractRanges(t *testing.T) {
+	for _, tc := range []struct {
+		a, b []rev_range
+		want []rev_range
+	}{
+		{[]rev_range{{1, 10, false}}, nil, []rev_range{{1, 10, false}}},
+		{[]rev_range{{1, 10, false}}, []rev_range{{1, 10, false}}, []rev_range{}},
+		{[]rev_range{{1, 10, false}}, []rev_range{{3, 4, false}}, []rev_range{{1, 2, false}, {5, 10, false}}},
+		{[]rev_range{{1, 10, false}}, []rev_range{{1, 2, false}, {9, 12, false}}, []rev_range{{3, 8, false}}},
+		{[]rev_range{{5, 5, true}}, []rev_range{{1, 4, false}}, []rev_range{{5, 5, true}}},
+	} {
+		if got := subtract_ranges(tc.a, tc.b); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("subtract_ranges(%v, %v): got %v, want %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+// TestMergeFilterSubdir checks that, with -subdir, the merges are read on
+// the branch roots, where SVN records them
+func TestMergeFilterSubdir(t *testing.T) {
+	ctx := new_test_repo(t)
+	ctx.Subdir = "lib"
+	ctx.TrunkBranch = "master"
+	c1 := commit_file(t, "a.txt", "1\n", "r1")
+	run_git(t, "checkout", "-q", "-b", "feature")
+	c2 := commit_file(t, "b.txt", "2\n", "r2")
+	c3 := commit_file(t, "b.txt", "3\n", "r3")
+	run_git(t, "checkout", "-q", "master")
+	c4 := commit_file(t, "b.txt", "3\n", "r4")
+	ctx.revs.add(rev_entry{Rev: 1, Ref: "svn/trunk", Commit: c1})
+	ctx.revs.add(rev_entry{Rev: 2, Ref: "svn/feature", Commit: c2})
+	ctx.revs.add(rev_entry{Rev: 3, Ref: "svn/feature", Commit: c3})
+	ctx.revs.add(rev_entry{Rev: 4, Ref: "svn/trunk", Commit: c4})
+
+	fake_svn(t, `
+root=http://svn.example.com/repo
+case "$*" in
+*/lib*) echo "unexpected subdir URL: $*" >&2; exit 1;;
+*"info --show-item repos-root-url"*) echo $root;;
+*"log --xml -v -q -r 2:4 $root/trunk@4")
+	echo '<log><logentry revision="4"><paths><path prop-mods="true">/trunk</path></paths></logentry></log>';;
+*"log --xml"*) echo '<log></log>';;
+*"proplist -v --xml $root/trunk@4")
+	echo '<properties><target path="x"><property name="svn:mergeinfo">/branches/feature:2-3</property></target></properties>';;
+*"proplist -v --xml"*) echo '<properties><target path="x"></target></properties>';;
+*"mergeinfo --show-revs eligible $root/branches/feature@3 $root/trunk@4") ;;
+*) echo "unexpected: $*" >&2; exit 1;;
+esac
+`)
+
+	mf, err := ctx.new_merge_filter(new_rewriter())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []svn_merge{{Commit: c4, Parent: c3, Report: 0}}
+	if got := mf.merges[c4]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("merges: got %+v, want %+v", got, want)
+	}
+	if len(ctx.report.Merges) != 1 || !strings.HasPrefix(ctx.report.Merges[0].Action, "merge commit") {
+		t.Fatalf("report: got %+v", ctx.report.Merges)
+	}
+}
+
+func TestMergeFilterParentNotRewritten(t *testing.T) {
+	ctx := new_test_repo(t)
+	src := commit_file(t, "a.txt", "a\n", "r2 on trunk")
+	run_git(t, "checkout", "-q", "--orphan", "gone")
+	gone := commit_file(t, "b.txt", "b\n", "r3 on a deleted branch")
+	run_git(t, "update-ref", "refs/remotes/svn/gone", gone)
+	run_git(t, "checkout", "-q", "master")
+	run_git(t, "branch", "-D", "gone")
+
+	ctx.report.Merges = []ReportMerge{{Revision: 5}, {Revision: 6}}
+	mf := &merge_filter{
+		ctx: ctx,
+		rw:  new_rewriter(),
+		merges: map[string][]svn_merge{
+			"c5": {{Commit: "c5", Parent: gone, Report: 0}},
+			"c6": {{Commit: "c6", Parent: src, Report: 1}},
+		},
+	}
+
+	// the merged commit is not converted
+	c5 := &fi_commit{OrigID: "c5", From: ":1"}
+	err := mf.filter(c5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c5.Merges) != 0 || !strings.HasPrefix(ctx.report.Merges[0].Action, "not represented") {
+		t.Fatalf("got merges %v, action %q", c5.Merges, ctx.report.Merges[0].Action)
+	}
+
+	// the merged commit is on master, but not rewritten yet
+	err = mf.filter(&fi_commit{OrigID: "c6", From: ":1"})
+	if err == nil || !strings.Contains(err.Error(), "out of order") {
+		t.Fatalf("got %v, want an error for the merge of a later commit", err)
+	}
+
+	// once rewritten, it is merged
+	mf.rw.orig[src] = ":2"
+	c6 := &fi_commit{OrigID: "c6", From: ":1"}
+	err = mf.filter(c6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c6.Merges, []string{":2"}) {
+		t.Fatalf("got merges %v, want [:2]", c6.Merges)
+	}
+}
+
+// EOF
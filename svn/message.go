@@ -0,0 +1,194 @@
+package svn
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// default replacement of the empty commit messages of MessageCleanup
+const g_empty_message = "(no commit message)"
+
+// ReportMessages summarizes the cleanup of commit and tag messages
+type ReportMessages struct {
+	Rewritten int `json:"rewritten"` // messages changed by the cleanup
+	Empty     int `json:"empty"`     // empty messages replaced by EmptyMessage
+}
+
+// built-in cleanup rules: messages left over by SVN clients and cvs2svn
+var g_message_rules = []message_rule{
+	{regexp.MustCompile(`(?m)^\s*\*\*\* empty log message \*\*\*\s*$`), ""},
+	{regexp.MustCompile(`(?m)^This commit was manufactured by cvs2svn to create (branch|tag) '([^']*)'\.$`), "Create $1 $2"},
+	{regexp.MustCompile(`(?m)^This commit was manufactured by cvs2svn to accommodate a server-side copy/move\.$`), "Accommodate a server-side copy/move"},
+	{regexp.MustCompile(`(?m)[ \t\r]+$`), ""},
+	{regexp.MustCompile(`\n{3,}`), "\n\n"},
+}
+
+// message_rule replaces the matches of a regular expression in messages
+type message_rule struct {
+	re   *regexp.Regexp
+	repl string // replacement, with $1-style group references
+}
+
+// parse_message_rule parses a sed-like "s/REGEX/REPLACEMENT/FLAGS" rule.
+// Any character may be used as the delimiter instead of '/' (escaped with
+// a backslash within REGEX and REPLACEMENT), and FLAGS may contain 'i'
+// (case insensitive) and 'm' (multi-line: ^ and $ match at line ends).
+// All the matches are replaced.
+func parse_message_rule(rule string) (message_rule, error) {
+	if len(rule) < 2 || rule[0] != 's' {
+		return message_rule{}, fmt.Errorf("invalid message rule %q (want s/REGEX/REPLACEMENT/)", rule)
+	}
+	delim := rule[1]
+	parts := []string{}
+	cur := []byte{}
+	for i := 2; i < len(rule); i++ {
+		switch {
+		case rule[i] == '\\' && i+1 < len(rule) && rule[i+1] == delim:
+			cur = append(cur, delim)
+			i++
+		case rule[i] == delim:
+			parts = append(parts, string(cur))
+			cur = []byte{}
+		default:
+			cur = append(cur, rule[i])
+		}
+	}
+	if len(parts) != 2 {
+		return message_rule{}, fmt.Errorf("invalid message rule %q (want s/REGEX/REPLACEMENT/)", rule)
+	}
+	flags := string(cur)
+	if strings.Trim(flags, "im") != "" {
+		return message_rule{}, fmt.Errorf("invalid flags %q in message rule %q", flags, rule)
+	}
+	expr := parts[0]
+	if flags != "" {
+		expr = "(?" + flags + ")" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return message_rule{}, fmt.Errorf("invalid message rule %q: %v", rule, err)
+	}
+	return message_rule{re: re, repl: parts[1]}, nil
+}
+
+// message_filter is a commit and tag filter cleaning up messages: the
+// built-in rules (MessageCleanup), then the user rules (MessageRules),
+// then the external command (MessageFilter)
+type message_filter struct {
+	ctx   *Context
+	rules []message_rule
+}
+
+func (ctx *Context) new_message_filter() (*message_filter, error) {
+	mf := &message_filter{
+		ctx:   ctx,
+		rules: []message_rule{},
+	}
+	for _, rule := range ctx.MessageRules {
+		r, err := parse_message_rule(rule)
+		if err != nil {
+			return nil, err
+		}
+		mf.rules = append(mf.rules, r)
+	}
+	return mf, nil
+}
+
+func (mf *message_filter) filter(c *fi_commit) error {
+	env := []string{
+		"SVN2GIT_COMMIT=" + c.OrigID,
+		"SVN2GIT_REF=" + c.Ref,
+	}
+	if e, ok := mf.ctx.revs.commit(c.OrigID); ok {
+		env = append(env,
+			"SVN2GIT_REVISION="+strconv.Itoa(e.Rev),
+			"SVN2GIT_SVN_PATH="+mf.ctx.svn_rel_path(e.Ref),
+		)
+	}
+	msg, err := mf.clean(c.Msg, env)
+	if err != nil {
+		return fmt.Errorf("commit %s: %v", c.OrigID, err)
+	}
+	c.Msg = msg
+	return nil
+}
+
+func (mf *message_filter) filter_tag(t *fi_tag) error {
+	env := []string{
+		"SVN2GIT_COMMIT=" + t.OrigID,
+		"SVN2GIT_REF=refs/tags/" + t.Name,
+	}
+	msg, err := mf.clean(t.Msg, env)
+	if err != nil {
+		return fmt.Errorf("tag %s: %v", t.Name, err)
+	}
+	t.Msg = msg
+	return nil
+}
+
+// clean returns the cleaned up msg. The git-svn-id line of msg, if any, is
+// set aside while the rules and the external command run.
+func (mf *message_filter) clean(msg []byte, env []string) ([]byte, error) {
+	ctx := mf.ctx
+	id := g_svn_id_re.Find(msg)
+	body := g_svn_id_re.ReplaceAll(msg, nil)
+
+	out := append([]byte{}, body...)
+	if ctx.MessageCleanup {
+		for _, r := range g_message_rules {
+			out = r.re.ReplaceAll(out, []byte(r.repl))
+		}
+	}
+	for _, r := range mf.rules {
+		out = r.re.ReplaceAll(out, []byte(r.repl))
+	}
+	if ctx.MessageFilter != "" {
+		var err error
+		out, err = ctx.run_message_filter(out, env)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if ctx.MessageCleanup {
+		out = bytes.Trim(out, " \t\r\n")
+		if len(out) == 0 {
+			out = []byte(ctx.EmptyMessage)
+			ctx.report.Messages.Empty++
+		}
+		out = append(out, '\n')
+	}
+
+	if !bytes.Equal(out, body) {
+		ctx.report.Messages.Rewritten++
+	}
+	if len(id) > 0 {
+		out = bytes.TrimRight(out, "\n")
+		if len(out) > 0 {
+			out = append(out, "\n\n"...)
+		}
+		out = append(out, bytes.TrimRight(id, "\n")...)
+		out = append(out, '\n')
+	}
+	return out, nil
+}
+
+// run_message_filter pipes msg through the MessageFilter shell command,
+// with env added to its environment
+func (ctx *Context) run_message_filter(msg []byte, env []string) ([]byte, error) {
+	cmd := exec.Command("sh", "-c", ctx.MessageFilter)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = bytes.NewReader(msg)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("message filter %q: %v", ctx.MessageFilter, err)
+	}
+	return out, nil
+}
+
+// EOF
@@ -0,0 +1,79 @@
+package svn
+
+import (
+	"testing"
+)
+
+func TestParseMessageRule(t *testing.T) {
+	for _, tc := range []struct {
+		rule string
+		in   string
+		want string
+		err  bool
+	}{
+		{rule: `s/foo/bar/`, in: "foo foo", want: "bar bar"},
+		{rule: `s/(\w+)@example\.com/<$1>/`, in: "by jdoe@example.com", want: "by <jdoe>"},
+		{rule: `s|a/b|c|`, in: "a/b", want: "c"},
+		{rule: `s/a\/b/c/`, in: "a/b", want: "c"},
+		{rule: `s/FOO//i`, in: "foo bar", want: " bar"},
+		{rule: `s/^x$/y/m`, in: "a\nx\nb", want: "a\ny\nb"},
+		{rule: `s/^x$/y/`, in: "a\nx\nb", want: "a\nx\nb"},
+		{rule: `s/^x$/y/im`, in: "a\nX\nb", want: "a\ny\nb"},
+		{rule: ``, err: true},
+		{rule: `x/foo/bar/`, err: true},
+		{rule: `s/foo/bar`, err: true},
+		{rule: `s/foo/bar/baz/`, err: true},
+		{rule: `s/foo/bar/g`, err: true},
+		{rule: `s/(foo/bar/`, err: true},
+	} {
+		r, err := parse_message_rule(tc.rule)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%q: expected an error", tc.rule)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tc.rule, err)
+			continue
+		}
+		if got := r.re.ReplaceAllString(tc.in, r.repl); got != tc.want {
+			t.Errorf("%q on %q: got %q, want %q", tc.rule, tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestMessageFilterClean(t *testing.T) {
+	ctx := NewContext("http://svn.example.com/repo")
+	ctx.report = ctx.new_report()
+	ctx.MessageCleanup = true
+	ctx.MessageRules = []string{`s/#(\d+)/GH-$1/`}
+	mf, err := ctx.new_message_filter()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const id = "git-svn-id: http://svn.example.com/repo/trunk@5 0bc5e1ab-6d8f-4a2c-9c3a-4a0e8c2b1f00\n"
+	for _, tc := range []struct {
+		in   string
+		want string
+	}{
+		{"fix #12  \n\n\n\nmore\n\n" + id, "fix GH-12\n\nmore\n\n" + id},
+		{"*** empty log message ***\n\n" + id, g_empty_message + "\n\n" + id},
+		{"This commit was manufactured by cvs2svn to create tag 'v1'.\n", "Create tag v1\n"},
+		{"", g_empty_message + "\n"},
+	} {
+		got, err := mf.clean([]byte(tc.in), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("clean(%q): got %q, want %q", tc.in, got, tc.want)
+		}
+	}
+	if got := ctx.report.Messages.Empty; got != 2 {
+		t.Errorf("empty messages: got %d, want 2", got)
+	}
+}
+
+// EOF
@@ -0,0 +1,225 @@
+package svn
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// path_rule moves the directory (or file) Src to Dst. An empty Src or Dst
+// is the root of the branch.
+type path_rule struct {
+	Src string
+	Dst string
+}
+
+func (r path_rule) String() string {
+	return "/" + r.Src + " -> /" + r.Dst
+}
+
+// clean_rule_path cleans up a path of a rule ("" for the root)
+func clean_rule_path(p string) string {
+	p = strings.Trim(path.Clean("/"+p), "/")
+	if p == "." {
+		return ""
+	}
+	return p
+}
+
+// parse_path_rule parses a "SRC=DST" path rule
+func parse_path_rule(rule string) (path_rule, error) {
+	i := strings.Index(rule, "=")
+	if i < 0 {
+		return path_rule{}, fmt.Errorf("invalid path rule %q (want SRC=DST)", rule)
+	}
+	r := path_rule{
+		Src: clean_rule_path(rule[:i]),
+		Dst: clean_rule_path(rule[i+1:]),
+	}
+	if r.Src == r.Dst {
+		return path_rule{}, fmt.Errorf("invalid path rule %q: nothing to move", rule)
+	}
+	return r, nil
+}
+
+// is_under returns whether p is dir or a path below dir ("" is the root)
+func is_under(p, dir string) bool {
+	return dir == "" || p == dir || strings.HasPrefix(p, dir+"/")
+}
+
+// path_mapper rewrites paths according to a list of rules. The rule with
+// the longest matching Src applies; rules are not chained.
+type path_mapper struct {
+	rules []path_rule // sorted by decreasing Src length
+}
+
+// new_path_mapper parses and validates rules
+func new_path_mapper(rules []string) (*path_mapper, error) {
+	pm := &path_mapper{rules: []path_rule{}}
+	srcs := make(map[string]bool)
+	for _, s := range rules {
+		r, err := parse_path_rule(s)
+		if err != nil {
+			return nil, err
+		}
+		if srcs[r.Src] {
+			return nil, fmt.Errorf("path rules: /%s is moved twice", r.Src)
+		}
+		srcs[r.Src] = true
+		pm.rules = append(pm.rules, r)
+	}
+	sort.Stable(path_rules(pm.rules))
+	return pm, nil
+}
+
+// apply returns the rewrite of the path p
+func (pm *path_mapper) apply(p string) string {
+	for _, r := range pm.rules {
+		if !is_under(p, r.Src) {
+			continue
+		}
+		rest := strings.TrimPrefix(strings.TrimPrefix(p, r.Src), "/")
+		return strings.Trim(r.Dst+"/"+rest, "/")
+	}
+	return p
+}
+
+// sources returns the paths which apply rewrites to p (including p itself,
+// unless a rule moves it)
+func (pm *path_mapper) sources(p string) []string {
+	srcs := []string{}
+	if pm.apply(p) == p {
+		srcs = append(srcs, p)
+	}
+	for _, r := range pm.rules {
+		if !is_under(p, r.Dst) {
+			continue
+		}
+		rest := strings.TrimPrefix(strings.TrimPrefix(p, r.Dst), "/")
+		src := strings.Trim(r.Src+"/"+rest, "/")
+		if src != p && pm.apply(src) == p {
+			srcs = append(srcs, src)
+		}
+	}
+	return srcs
+}
+
+// check returns an error if the rewrite of the file paths collide: two
+// files moved to the same path, or a file moved to a directory of another
+func (pm *path_mapper) check(paths []string) error {
+	moved := make(map[string]string, len(paths)) // new path -> original path
+	for _, p := range paths {
+		np := pm.apply(p)
+		if o, dup := moved[np]; dup && o != p {
+			return fmt.Errorf("%s and %s are both moved to %s", o, p, np)
+		}
+		moved[np] = p
+	}
+	for np, p := range moved {
+		for dir := path.Dir(np); dir != "." && dir != "/"; dir = path.Dir(dir) {
+			if o, ok := moved[dir]; ok {
+				return fmt.Errorf("%s is moved to %s, a directory of %s (from %s)", o, dir, np, p)
+			}
+		}
+	}
+	return nil
+}
+
+// path_filter is a commit filter applying the path rules to the file
+// changes of the commits.
+// Collisions are checked on the tips of the branches and tags before the
+// rewrite, and on the files changed by each commit during the rewrite.
+type path_filter struct {
+	ctx   *Context
+	pm    *path_mapper
+	moved map[string][]string // new path -> original paths moved to it so far
+}
+
+// new_path_filter validates the path rules against the tips of the branches
+// and tags to rewrite
+func (ctx *Context) new_path_filter() (*path_filter, error) {
+	pm, err := new_path_mapper(ctx.PathRules)
+	if err != nil {
+		return nil, err
+	}
+	refs := []string{}
+	for _, prefix := range []string{"refs/heads/", "refs/tags/"} {
+		names, err := ctx.list_refs(prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			refs = append(refs, prefix+name)
+		}
+	}
+	for _, ref := range refs {
+		out, err := ctx.git_output("ls-tree", "-r", "-z", "--name-only", ref+"^{commit}")
+		if err != nil {
+			return nil, err
+		}
+		paths := []string{}
+		for _, p := range bytes.Split(out, []byte{0}) {
+			if len(p) > 0 {
+				paths = append(paths, string(p))
+			}
+		}
+		err = pm.check(paths)
+		if err != nil {
+			return nil, fmt.Errorf("path rules: %s: %v", ref, err)
+		}
+	}
+	return &path_filter{
+		ctx:   ctx,
+		pm:    pm,
+		moved: make(map[string][]string),
+	}, nil
+}
+
+func (f *path_filter) filter(c *fi_commit) error {
+	changed := []string{}
+	for i := range c.Files {
+		file := &c.Files[i]
+		switch file.Op {
+		case 0:
+			continue
+		case 'M':
+			changed = append(changed, file.Path)
+		case 'C', 'R':
+			changed = append(changed, file.Dest)
+			file.Dest = f.pm.apply(file.Dest)
+		}
+		file.Path = f.pm.apply(file.Path)
+	}
+	err := f.pm.check(changed)
+	if err != nil {
+		return fmt.Errorf("path rules: commit %s: %v", c.OrigID, err)
+	}
+
+	// a file moved to the path of another file is a collision if the
+	// other file is still there
+	for _, p := range changed {
+		np := f.pm.apply(p)
+		for _, o := range f.moved[np] {
+			if o == p {
+				continue
+			}
+			if _, err := f.ctx.git_output("cat-file", "-e", c.OrigID+":"+o); err == nil {
+				return fmt.Errorf("path rules: commit %s: %s and %s are both moved to %s", c.OrigID, o, p, np)
+			}
+		}
+		if !is_in_slice(p, f.moved[np]) {
+			f.moved[np] = append(f.moved[np], p)
+		}
+	}
+	return nil
+}
+
+type path_rules []path_rule
+
+func (p path_rules) Len() int           { return len(p) }
+func (p path_rules) Less(i, j int) bool { return len(p[i].Src) > len(p[j].Src) }
+func (p path_rules) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// EOF
@@ -0,0 +1,98 @@
+package svn
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePathRule(t *testing.T) {
+	for rule, want := range map[string]path_rule{
+		"src=lib":         {Src: "src", Dst: "lib"},
+		"/src/main/=/lib": {Src: "src/main", Dst: "lib"},
+		"=project":        {Src: "", Dst: "project"},
+		"trunk/x=/":       {Src: "trunk/x", Dst: ""},
+	} {
+		got, err := parse_path_rule(rule)
+		if err != nil {
+			t.Errorf("%q: %v", rule, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%q: got %v, want %v", rule, got, want)
+		}
+	}
+	for _, rule := range []string{"src", "src=src/", "/=."} {
+		if _, err := parse_path_rule(rule); err == nil {
+			t.Errorf("%q: expected an error", rule)
+		}
+	}
+	if _, err := new_path_mapper([]string{"src=a", "/src/=b"}); err == nil {
+		t.Errorf("src moved twice: expected an error")
+	}
+}
+
+func TestPathMapperApply(t *testing.T) {
+	pm, err := new_path_mapper([]string{"src=lib", "src/main=main", "doc/a.txt=README", "=project"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]string{
+		"src":           "lib",
+		"src/a.c":       "lib/a.c",
+		"src/main/x.c":  "main/x.c",
+		"src/mainx/x.c": "lib/mainx/x.c",
+		"srcx/y.c":      "project/srcx/y.c",
+		"doc/a.txt":     "README",
+		"doc/b.txt":     "project/doc/b.txt",
+		"":              "project",
+	} {
+		if got := pm.apply(path); got != want {
+			t.Errorf("apply(%q): got %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestPathMapperCheck(t *testing.T) {
+	pm, err := new_path_mapper([]string{"a=c", "b=c/d", "x/y=z"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		paths []string
+		err   bool
+	}{
+		{paths: []string{"a/1", "b/1", "x/y/1", "x/1"}},
+		{paths: []string{"a/1", "c/1"}, err: true},
+		{paths: []string{"a/1", "a/1"}},
+		{paths: []string{"a/d/1", "b/1"}, err: true},
+		{paths: []string{"a/z", "z"}},
+		{paths: []string{"z", "x/y"}, err: true},
+		{paths: []string{"a/d", "b/1"}, err: true},
+	} {
+		err := pm.check(tc.paths)
+		if (err != nil) != tc.err {
+			t.Errorf("check(%q): got %v, want error=%v", tc.paths, err, tc.err)
+		}
+	}
+}
+
+func TestPathMapperSources(t *testing.T) {
+	pm, err := new_path_mapper([]string{"src=lib", "src/main=main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string][]string{
+		"lib/a.c":    {"lib/a.c", "src/a.c"},
+		"main/x.c":   {"main/x.c", "src/main/x.c"},
+		"README":     {"README"},
+		"src/a.c":    {},
+		"lib/main/x": {"lib/main/x"},
+	} {
+		got := pm.sources(path)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("sources(%q): got %q, want %q", path, got, want)
+		}
+	}
+}
+
+// EOF
@@ -0,0 +1,189 @@
+package svn
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// Path filters (-exclude, -include) match the paths of the files relative
+// to the root of trunk, of a branch or of a tag (e.g. "doc/index.html"),
+// whatever the repository layout. A pattern is either:
+//  - a regular expression, anchored at the start of the path: "doc"
+//    matches "doc/index.html" and "doc.txt", but not "src/doc/x.c";
+//  - a glob, prefixed with "glob:", matching the whole path or one of its
+//    parent directories: "glob:doc" matches "doc/index.html" but not
+//    "doc.txt". '*' and '?' do not match '/', and "**" matches any number
+//    of directories: "glob:**/*.jpg" matches the JPEG files at any depth.
+
+const g_glob_prefix = "glob:"
+
+// path_regexp returns the regular expression of a path filter pattern
+func path_regexp(pattern string) (string, error) {
+	if !strings.HasPrefix(pattern, g_glob_prefix) {
+		_, err := regexp.Compile(pattern)
+		if err != nil {
+			return "", fmt.Errorf("invalid path pattern %q: %v", pattern, err)
+		}
+		return pattern, nil
+	}
+
+	glob := strings.Trim(pattern[len(g_glob_prefix):], "/")
+	if glob == "" {
+		return "", fmt.Errorf("invalid path pattern %q: empty glob", pattern)
+	}
+	re := ""
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			re += "(?:.*/)?"
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			re += ".*"
+			i++
+		case c == '*':
+			re += "[^/]*"
+		case c == '?':
+			re += "[^/]"
+		case c == '[':
+			j := strings.IndexByte(glob[i+1:], ']')
+			if j < 0 {
+				return "", fmt.Errorf("invalid path pattern %q: unterminated [", pattern)
+			}
+			class := glob[i+1 : i+1+j]
+			if strings.HasPrefix(class, "!") {
+				class = "^/" + class[1:]
+			}
+			re += "[" + class + "]"
+			i += j + 1
+		case c == '\\' && i+1 < len(glob):
+			re += regexp.QuoteMeta(glob[i+1 : i+2])
+			i++
+		default:
+			re += regexp.QuoteMeta(string(c))
+		}
+	}
+	re += "(?:/|$)"
+	if _, err := regexp.Compile(re); err != nil {
+		return "", fmt.Errorf("invalid path pattern %q: %v", pattern, err)
+	}
+	return re, nil
+}
+
+// path_filter_regexp returns the regular expression matching the paths of
+// patterns relative to the root of the branches (e.g. "^(?:doc|.*~$)"), or
+// "" if there is no pattern
+func path_filter_regexp(patterns []string) (string, error) {
+	res := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := path_regexp(p)
+		if err != nil {
+			return "", err
+		}
+		res = append(res, re)
+	}
+	if len(res) == 0 {
+		return "", nil
+	}
+	return "^(?:" + strings.Join(res, "|") + ")", nil
+}
+
+// excludes returns the -exclude patterns
+func (ctx *Context) excludes() []string {
+	patterns := []string{}
+	if ctx.Exclude != "" {
+		patterns = append(patterns, ctx.Exclude)
+	}
+	return append(patterns, ctx.Excludes...)
+}
+
+// git_svn_path_regexp returns the regular expression git-svn matches the
+// paths relative to the SVN URL against, for path filters matching re
+// relative to the root of the branches
+func (ctx *Context) git_svn_path_regexp(re string) string {
+	prefixes := []string{}
+	if !ctx.RootIsTrunk {
+		if ctx.Trunk != "" {
+			prefixes = append(prefixes, regexp.QuoteMeta(ctx.Trunk)+"[/]")
+		}
+		if ctx.Tags != "" {
+			prefixes = append(prefixes, regexp.QuoteMeta(ctx.Tags)+"[/][^/]+[/]")
+		}
+		if ctx.Branches != "" {
+			prefixes = append(prefixes, regexp.QuoteMeta(ctx.Branches)+"[/][^/]+[/]")
+		}
+	}
+	sub := ""
+	if ctx.subdir() != "" {
+		// the paths are relative to the -subdir directory of each branch
+		sub = regexp.QuoteMeta(ctx.subdir()) + "[/]"
+	}
+	return fmt.Sprintf("^(?:%s)%s(?:%s)",
+		strings.Join(prefixes, "|"),
+		sub,
+		strings.TrimPrefix(re, "^"),
+	)
+}
+
+// set_path_filters configures the -exclude and -include filters of the
+// git-svn remote
+func (ctx *Context) set_path_filters(remote string) error {
+	var err error = nil
+	exclude, err := path_filter_regexp(ctx.excludes())
+	if err != nil {
+		return err
+	}
+	include, err := path_filter_regexp(ctx.Includes)
+	if err != nil {
+		return err
+	}
+
+	cfg := [][]string{}
+	if exclude != "" {
+		cfg = append(cfg, []string{"ignore-paths", ctx.git_svn_path_regexp(exclude)})
+	}
+	if include != "" {
+		cfg = append(cfg, []string{"include-paths", ctx.git_svn_path_regexp(include)})
+	}
+	for _, kv := range cfg {
+		cmd := exec.Command("git", "config", "--local",
+			"svn-remote."+remote+"."+kv[0], kv[1])
+		ctx.print_cmd(cmd)
+		ctx.debug_cmd(cmd)
+		err = cmd.Run()
+		if err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// path_converted returns a function telling whether a path relative to the
+// root of a branch passes the -exclude and -include filters
+func (ctx *Context) path_converted() (func(path string) bool, error) {
+	exclude, err := path_filter_regexp(ctx.excludes())
+	if err != nil {
+		return nil, err
+	}
+	include, err := path_filter_regexp(ctx.Includes)
+	if err != nil {
+		return nil, err
+	}
+	var ex, in *regexp.Regexp
+	if exclude != "" {
+		ex = regexp.MustCompile(exclude)
+	}
+	if include != "" {
+		in = regexp.MustCompile(include)
+	}
+	return func(path string) bool {
+		if ex != nil && ex.MatchString(path) {
+			return false
+		}
+		return in == nil || in.MatchString(path)
+	}, nil
+}
+
+// EOF
@@ -0,0 +1,148 @@
+package svn
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestPathRegexp(t *testing.T) {
+	for _, tc := range []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"doc", "doc/index.html", true},
+		{"doc", "doc.txt", true},
+		{"doc", "src/doc/x.c", false},
+		{".*~$", "src/x.c~", true},
+		{"glob:doc", "doc/index.html", true},
+		{"glob:doc", "doc", true},
+		{"glob:doc", "doc.txt", false},
+		{"glob:/doc/", "doc/index.html", true},
+		{"glob:*.jpg", "a.jpg", true},
+		{"glob:*.jpg", "img/a.jpg", false},
+		{"glob:**/*.jpg", "a.jpg", true},
+		{"glob:**/*.jpg", "img/x/a.jpg", true},
+		{"glob:img/**", "img/x/a.jpg", true},
+		{"glob:img/**", "img", false},
+		{"glob:src/?.c", "src/a.c", true},
+		{"glob:src/?.c", "src/ab.c", false},
+		{"glob:src/[ab].c", "src/b.c", true},
+		{"glob:src/[!ab].c", "src/b.c", false},
+		{"glob:src/[!ab].c", "src/c.c", true},
+		{`glob:a\*b`, "a*b", true},
+		{`glob:a\*b`, "axb", false},
+		{"glob:a.b", "axb", false},
+	} {
+		re, err := path_regexp(tc.pattern)
+		if err != nil {
+			t.Errorf("%q: %v", tc.pattern, err)
+			continue
+		}
+		got := regexp.MustCompile("^(?:" + re + ")").MatchString(tc.path)
+		if got != tc.match {
+			t.Errorf("%q (%s) on %q: got %v, want %v", tc.pattern, re, tc.path, got, tc.match)
+		}
+	}
+
+	for _, pattern := range []string{"(doc", "glob:", "glob:/", "glob:src/[ab.c"} {
+		if _, err := path_regexp(pattern); err == nil {
+			t.Errorf("%q: expected an error", pattern)
+		}
+	}
+}
+
+func TestPathFilterRegexp(t *testing.T) {
+	re, err := path_filter_regexp(nil)
+	if err != nil || re != "" {
+		t.Fatalf("no pattern: got (%q, %v)", re, err)
+	}
+	re, err = path_filter_regexp([]string{"doc", "glob:*.o"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `^(?:doc|[^/]*\.o(?:/|$))`; re != want {
+		t.Fatalf("got %q, want %q", re, want)
+	}
+}
+
+func TestGitSvnPathRegexp(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		setup   func(ctx *Context)
+		want    string
+		match   []string
+		nomatch []string
+	}{
+		{
+			name:    "standard",
+			setup:   func(ctx *Context) {},
+			want:    `^(?:trunk[/]|tags[/][^/]+[/]|branches[/][^/]+[/])(?:(?:doc))`,
+			match:   []string{"trunk/doc/a", "tags/1.0/doc", "branches/x/doc/a"},
+			nomatch: []string{"doc/a", "trunk/src/doc", "branches/doc/a"},
+		},
+		{
+			name:    "root-is-trunk",
+			setup:   func(ctx *Context) { ctx.RootIsTrunk = true },
+			want:    `^(?:)(?:(?:doc))`,
+			match:   []string{"doc/a"},
+			nomatch: []string{"trunk/doc/a"},
+		},
+		{
+			name: "subdir",
+			setup: func(ctx *Context) {
+				ctx.Branches = ""
+				ctx.Trunk = "main.dev"
+				ctx.Subdir = "/lib/"
+			},
+			want:    `^(?:main\.dev[/]|tags[/][^/]+[/])lib[/](?:(?:doc))`,
+			match:   []string{"main.dev/lib/doc", "tags/1.0/lib/doc/a"},
+			nomatch: []string{"main.dev/doc", "mainxdev/lib/doc", "branches/x/lib/doc"},
+		},
+	} {
+		ctx := NewContext("http://svn.example.com/repo")
+		tc.setup(ctx)
+		re := ctx.git_svn_path_regexp("^(?:doc)")
+		if re != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, re, tc.want)
+			continue
+		}
+		rx := regexp.MustCompile(re)
+		for _, p := range tc.match {
+			if !rx.MatchString(p) {
+				t.Errorf("%s: %q does not match %q", tc.name, re, p)
+			}
+		}
+		for _, p := range tc.nomatch {
+			if rx.MatchString(p) {
+				t.Errorf("%s: %q matches %q", tc.name, re, p)
+			}
+		}
+	}
+}
+
+func TestPathConverted(t *testing.T) {
+	ctx := NewContext("http://svn.example.com/repo")
+	ctx.Exclude = "doc/internal"
+	ctx.Excludes = []string{"glob:**/*.o"}
+	ctx.Includes = []string{"src", "doc"}
+	converted, err := ctx.path_converted()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]bool{
+		"src/a.c":         true,
+		"src/x/a.o":       false,
+		"doc/index.html":  true,
+		"doc/internal/a":  false,
+		"README":          false,
+		"tools/src/a.c":   false,
+		"srcfiles/list.c": true,
+	} {
+		if got := converted(path); got != want {
+			t.Errorf("%q: got %v, want %v", path, got, want)
+		}
+	}
+}
+
+// EOF
@@ -50,17 +50,77 @@ type Context struct {
 	NoMinimizeUrl bool   // accept URLs as-is without attempting to connect a higher level directory
 	RootIsTrunk   bool   // use this if the root level of the repo is equivalent to the trunk and there are no tags or branches
 	Rebase        bool   // instead of cloning a new project, rebase an existing one against SVN
+	Bare          bool   // produce a bare repository (no working tree, no checkouts)
+	TrunkBranch   string // name of the git branch trunk is converted into
 	UserName      string // username for transports that needs it (http(s), svn)
 	Trunk         string // subpath to trunk from repository URL
 	Branches      string // subpath to branches from repository URL
 	Tags          string // subpath to tags from repository URL
-	Exclude       string // regular expression to filter paths when fetching
+	Exclude       string // regular expression to filter paths when fetching (see also Excludes)
 	Revision      string // start importing from SVN revision START_REV; optionally end at END_REV. e.g. START_REV:END_REV
 
 	NoTrunk    bool   // do not import anything from trunk
 	NoBranches bool   // do not import anything from branches
 	NoTags     bool   // do not import anything from tags
 	Authors    string // path to file containing svn-to-git authors mapping
+
+	Subdir   string   // directory of trunk, branches and tags converted as the root of the git repository ("": the whole tree)
+	Excludes []string // patterns (regular expressions, or globs prefixed with "glob:") of the paths not to convert
+	Includes []string // patterns of the paths to convert, if any (the others are not converted)
+
+	PushRemote   string   // URL of a git remote to push the converted branches and tags to
+	PushRefspecs []string // refspecs to push (default: all local branches and tags)
+	PushMirror   bool     // push with --mirror instead of refspecs
+
+	VerifyRevisions int // number of historical trunk revisions compared by Verify
+
+	GitIgnore     bool   // convert svn:ignore and svn:global-ignores properties into .gitignore files
+	Externals     string // handling of svn:externals ("": ignore, or one of the Externals* modes)
+	ExternalsMap  string // path to file mapping SVN URLs to git URLs, for submodules
+	GitAttributes bool   // convert svn:eol-style, svn:mime-type and svn:keywords into .gitattributes
+	SvnProps      bool   // record the versioned properties no other option converts in a file of each branch
+	SvnPropsFile  string // name of the file recording the versioned properties (at the root of the branches)
+
+	LfsThreshold int64    // size (in bytes) above which files are moved to Git LFS (0: none)
+	LfsPatterns  []string // glob patterns of files moved to Git LFS
+
+	PathRules []string // "SRC=DST" rules moving directories (or files) in every commit
+
+	Mergeinfo  bool // turn complete merges recorded in svn:mergeinfo into git merge commits
+	PruneEmpty bool // drop the commits without file changes (e.g. property or directory changes)
+
+	SvnId       string // handling of the git-svn-id lines of commit messages (one of the SvnId* modes)
+	SvnIdFormat string // format of the trailers replacing git-svn-id lines ({rev}, {path} and {url} are expanded)
+
+	LogEncoding string // encoding of the commit messages and authors which are not valid UTF-8 (e.g. "cp1252")
+
+	Committer     string // "Name <email>" identity of the committers of the commits and annotated tags ("": the authors)
+	CommitterDate string // date of the committers (one of the CommitterDate* modes)
+
+	MessageCleanup bool     // clean up commit messages (trailing whitespace, "*** empty log message ***", cvs2svn artefacts)
+	EmptyMessage   string   // message replacing the empty ones, with MessageCleanup
+	MessageRules   []string // sed-like "s/REGEX/REPLACEMENT/" rules applied to commit messages
+	MessageFilter  string   // shell command filtering each commit message (stdin to stdout)
+
+	RevRefs       string   // handling of the SVN revision references of commit messages ("": none, or one of the RevRefs* modes)
+	RevRefRegexps []string // regular expressions of the SVN revision references (each group matches a revision)
+	RewriteDryRun bool     // only print the changes of commit messages the history rewrite would make
+
+	RevmapFiles []string // files (.csv or .json) the SVN revision <-> git commit mapping is exported to
+	SvnNotes    bool     // record the SVN revision of each commit in git notes (refs/notes/svn)
+
+	RevpropsNotes  bool   // record the non-standard SVN revision properties of each commit in git notes
+	RevpropsRef    string // notes ref of the SVN revision properties
+	RevpropsFormat string // format of the notes of the SVN revision properties (one of the Revprops* formats)
+
+	ModifiedTags string // handling of tags committed to after their creation (one of the Tags* policies)
+	Recreated    string // handling of previous incarnations of re-created branches and tags (one of the Recreated* policies)
+
+	ArchiveDeleted   bool   // import the branches and tags deleted from SVN under ArchiveNamespace
+	ArchiveNamespace string // namespace of the archived branches and tags (e.g. "refs/archive/")
+
+	report *Report // report of the current conversion
+	revs   *revmap // SVN revision <-> git commit mapping
 }
 
 func NewContext(svnurl string) *Context {
@@ -76,6 +136,8 @@ func NewContext(svnurl string) *Context {
 		NoMinimizeUrl: false,
 		RootIsTrunk:   false,
 		Rebase:        false,
+		Bare:          false,
+		TrunkBranch:   "master",
 		UserName:      "",
 		Trunk:         "trunk",
 		Branches:      "branches",
@@ -86,6 +148,59 @@ func NewContext(svnurl string) *Context {
 		NoBranches:    false,
 		NoTags:        false,
 		Authors:       os.ExpandEnv("$HOME/.config/go-svn2git/authors"),
+		Subdir:        "",
+		Excludes:      []string{},
+		Includes:      []string{},
+		PushRemote:    "",
+		PushRefspecs:  []string{},
+		PushMirror:    false,
+
+		VerifyRevisions: 0,
+
+		GitIgnore:     false,
+		Externals:     "",
+		ExternalsMap:  "",
+		GitAttributes: false,
+		SvnProps:      false,
+		SvnPropsFile:  g_svnprops_file,
+
+		LfsThreshold: 0,
+		LfsPatterns:  []string{},
+
+		PathRules: []string{},
+
+		Mergeinfo:  false,
+		PruneEmpty: false,
+
+		SvnId:       SvnIdKeep,
+		SvnIdFormat: "",
+
+		LogEncoding: "",
+
+		Committer:     "",
+		CommitterDate: CommitterDateSvn,
+
+		MessageCleanup: false,
+		EmptyMessage:   g_empty_message,
+		MessageRules:   []string{},
+		MessageFilter:  "",
+
+		RevRefs:       "",
+		RevRefRegexps: []string{},
+		RewriteDryRun: false,
+
+		RevmapFiles: []string{},
+		SvnNotes:    false,
+
+		RevpropsNotes:  false,
+		RevpropsRef:    g_revprops_ref,
+		RevpropsFormat: RevpropsText,
+
+		ModifiedTags: TagsTip,
+		Recreated:    RecreatedKeep,
+
+		ArchiveDeleted:   false,
+		ArchiveNamespace: "refs/archive/",
 	}
 	if !path_exists(ctx.Authors) {
 		ctx.Authors = ""
@@ -111,29 +226,22 @@ func NewContextFrom(svnurl string,
 	NoTags     bool,   // do not import anything from tags
 	Authors    string, // path to file containing svn-to-git authors mapping
 ) *Context {
-	ctx := &Context{
-		Repo: Repo{
-			local_branches:  []string{},
-			remote_branches: []string{},
-			tags:            []string{},
-		},
-		Url:           svnurl,
-		Verbose:       Verbose,
-		Metadata:      Metadata,
-		NoMinimizeUrl: NoMinimizeUrl,
-		RootIsTrunk:   RootIsTrunk,
-		Rebase:        Rebase,
-		UserName:      UserName,
-		Trunk:         Trunk,
-		Branches:      Branches,
-		Tags:          Tags,
-		Exclude:       Exclude,
-		Revision:      Revision,
-		NoTrunk:       NoTrunk,
-		NoBranches:    NoBranches,
-		NoTags:        NoTags,
-		Authors:       os.ExpandEnv(Authors),
-	}
+	ctx := NewContext(svnurl)
+	ctx.Verbose = Verbose
+	ctx.Metadata = Metadata
+	ctx.NoMinimizeUrl = NoMinimizeUrl
+	ctx.RootIsTrunk = RootIsTrunk
+	ctx.Rebase = Rebase
+	ctx.UserName = UserName
+	ctx.Trunk = Trunk
+	ctx.Branches = Branches
+	ctx.Tags = Tags
+	ctx.Exclude = Exclude
+	ctx.Revision = Revision
+	ctx.NoTrunk = NoTrunk
+	ctx.NoBranches = NoBranches
+	ctx.NoTags = NoTags
+	ctx.Authors = os.ExpandEnv(Authors)
 	if !path_exists(ctx.Authors) {
 		ctx.Authors = ""
 	}
@@ -172,38 +280,180 @@ func (ctx *Context) git_cmd(cmdargs ...string) []string {
 	return lines
 }
 
-func (ctx *Context) Run() error {
+// git_output runs git and returns its standard output.
+// Contrary to git_cmd, errors are reported.
+func (ctx *Context) git_output(cmdargs ...string) ([]byte, error) {
+	cmd := exec.Command("git", cmdargs...)
+	ctx.print_cmd(cmd)
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.Trim(stderr.String(), " \r\n")
+		if msg != "" {
+			return nil, fmt.Errorf("%s: %v (%s)", strings.Join(cmd.Args, " "), err, msg)
+		}
+		return nil, fmt.Errorf("%s: %v", strings.Join(cmd.Args, " "), err)
+	}
+	return out, nil
+}
+
+// list_refs returns the names of the refs under prefix (e.g. "refs/heads/"),
+// with the prefix stripped
+func (ctx *Context) list_refs(prefix string) ([]string, error) {
+	out, err := ctx.git_output("for-each-ref", "--format=%(refname)", prefix)
+	if err != nil {
+		return nil, err
+	}
+	refs := []string{}
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.Trim(line, " \r")
+		if line == "" {
+			continue
+		}
+		refs = append(refs, strings.TrimPrefix(line, prefix))
+	}
+	return refs, nil
+}
+
+// Run runs the conversion (or the rebase) and returns a report of what
+// was done. The report is returned even if the conversion failed.
+func (ctx *Context) Run() (*Report, error) {
 	var err error
+	ctx.report = ctx.new_report()
+	if ctx.Rebase && ctx.Bare {
+		return ctx.report, fmt.Errorf("'-rebase' can not be used on a bare repository")
+	}
+	switch ctx.SvnId {
+	case SvnIdKeep, SvnIdStrip, SvnIdTrailer:
+		// ok
+	default:
+		return ctx.report, fmt.Errorf("invalid '-svn-id' mode %q", ctx.SvnId)
+	}
+	if ctx.Rebase && ctx.has_rewrites() {
+		return ctx.report, fmt.Errorf("'-rebase' can not be used with options rewriting the history")
+	}
+	if ctx.RewriteDryRun && (ctx.PushRemote != "" || len(ctx.RevmapFiles) > 0 || ctx.SvnNotes || ctx.RevpropsNotes) {
+		return ctx.report, fmt.Errorf("'-rewrite-dry-run' can not be used with '-push-to', '-revmap', '-svn-notes' or '-revprops-notes'")
+	}
 	if ctx.Rebase {
-		err = ctx.get_branches()
+		err = ctx.run_phase("get-branches", ctx.get_branches)
 	} else {
-		err = ctx.do_clone()
+		err = ctx.run_phase("clone", ctx.do_clone)
 	}
 	if err != nil {
-		return err
+		return ctx.report, err
 	}
 
-	err = ctx.fix_tags()
+	ctx.revs, err = ctx.load_revmap()
 	if err != nil {
-		return err
+		return ctx.report, err
 	}
 
-	err = ctx.fix_branches()
+	err = ctx.run_phase("fix-recreated", ctx.fix_recreated)
 	if err != nil {
-		return err
+		return ctx.report, err
 	}
 
-	err = ctx.fix_trunk()
+	err = ctx.run_phase("fix-tags", ctx.fix_tags)
 	if err != nil {
-		return err
+		return ctx.report, err
 	}
 
-	err = ctx.optimize_repos()
+	err = ctx.run_phase("fix-branches", ctx.fix_branches)
 	if err != nil {
-		return err
+		return ctx.report, err
 	}
 
-	return err
+	err = ctx.run_phase("fix-trunk", ctx.fix_trunk)
+	if err != nil {
+		return ctx.report, err
+	}
+
+	if ctx.ArchiveDeleted {
+		err = ctx.run_phase("archive-deleted", ctx.archive_deleted)
+		if err != nil {
+			return ctx.report, err
+		}
+	}
+
+	// refresh the mapping: a rebase fetches new revisions
+	ctx.revs, err = ctx.load_revmap()
+	if err != nil {
+		return ctx.report, err
+	}
+
+	// a dry run only previews the rewrite of the converted history: no
+	// file is generated, and nothing is exported nor pushed
+	gen := !ctx.RewriteDryRun
+
+	if ctx.GitIgnore && gen {
+		err = ctx.run_phase("gitignore", ctx.convert_ignores)
+		if err != nil {
+			return ctx.report, err
+		}
+	}
+
+	if ctx.GitAttributes && gen {
+		err = ctx.run_phase("gitattributes", ctx.convert_attributes)
+		if err != nil {
+			return ctx.report, err
+		}
+	}
+
+	if ctx.Externals != "" && gen {
+		err = ctx.run_phase("externals", ctx.convert_externals)
+		if err != nil {
+			return ctx.report, err
+		}
+	}
+
+	if ctx.SvnProps && gen {
+		err = ctx.run_phase("svnprops", ctx.record_svnprops)
+		if err != nil {
+			return ctx.report, err
+		}
+	}
+
+	if ctx.has_rewrites() {
+		err = ctx.run_phase("rewrite", ctx.rewrite_history)
+		if err != nil {
+			return ctx.report, err
+		}
+	}
+	if ctx.RewriteDryRun {
+		err = ctx.fill_report()
+		return ctx.report, err
+	}
+
+	if len(ctx.RevmapFiles) > 0 || ctx.SvnNotes {
+		err = ctx.run_phase("export-revmap", ctx.export_revmap)
+		if err != nil {
+			return ctx.report, err
+		}
+	}
+
+	if ctx.RevpropsNotes {
+		err = ctx.run_phase("revprops", ctx.record_revprops)
+		if err != nil {
+			return ctx.report, err
+		}
+	}
+
+	err = ctx.run_phase("optimize", ctx.optimize_repos)
+	if err != nil {
+		return ctx.report, err
+	}
+
+	if ctx.PushRemote != "" {
+		err = ctx.run_phase("push", ctx.push_repos)
+		if err != nil {
+			return ctx.report, err
+		}
+	}
+
+	err = ctx.fill_report()
+	return ctx.report, err
 }
 
 func (ctx *Context) get_branches() error {
@@ -286,6 +536,29 @@ func (ctx *Context) get_branches() error {
 func (ctx *Context) do_clone() error {
 	var err error = nil
 
+	// create the repository ourselves so HEAD points at the trunk branch
+	// before git-svn checks anything out.
+	// (git-svn happily works in an existing, possibly bare, repository.)
+	{
+		cmds := [][]string{
+			{"git", "init"},
+			{"git", "symbolic-ref", "HEAD", "refs/heads/" + ctx.TrunkBranch},
+			{"git", "config", "--local", "init.defaultBranch", ctx.TrunkBranch},
+		}
+		if ctx.Bare {
+			cmds[0] = append(cmds[0], "--bare")
+		}
+		for _, cmdargs := range cmds {
+			cmd := exec.Command(cmdargs[0], cmdargs[1:]...)
+			ctx.print_cmd(cmd)
+			ctx.debug_cmd(cmd)
+			err = cmd.Run()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
 	cmdargs := []string{
 		"svn", "init", "--prefix=svn/",
 	}
@@ -296,7 +569,7 @@ func (ctx *Context) do_clone() error {
 		if ctx.UserName != "" {
 			cmdargs = append(cmdargs, fmt.Sprintf("--username=%s", ctx.UserName))
 		}
-		if ctx.Metadata {
+		if !ctx.Metadata {
 			cmdargs = append(cmdargs, "--no-metadata")
 		}
 		if ctx.NoMinimizeUrl {
@@ -308,7 +581,7 @@ func (ctx *Context) do_clone() error {
 		if ctx.UserName != "" {
 			cmdargs = append(cmdargs, fmt.Sprintf("--username=%s", ctx.UserName))
 		}
-		if ctx.Metadata {
+		if !ctx.Metadata {
 			cmdargs = append(cmdargs, "--no-metadata")
 		}
 		if ctx.NoMinimizeUrl {
@@ -337,6 +610,11 @@ func (ctx *Context) do_clone() error {
 		return err
 	}
 
+	err = ctx.set_subdir("svn")
+	if err != nil {
+		return err
+	}
+
 	if ctx.Authors != "" {
 		cmd := exec.Command("git", "config", "--local", "svn.authorsfile",
 			ctx.Authors)
@@ -384,25 +662,12 @@ func (ctx *Context) do_clone() error {
 			fmt.Sprintf("%s:%s", rev[0], rev[1]),
 		)
 	}
-	if ctx.Exclude != "" {
-		patterns := []string{}
-		if ctx.RootIsTrunk {
-			if ctx.Trunk != "" {
-				patterns = append(patterns, ctx.Trunk+"[/]")
-			}
-			if ctx.Tags != "" {
-				patterns = append(patterns, ctx.Tags+"[/][^/]+[/]")
-			}
-			if ctx.Branches != "" {
-				patterns = append(patterns, ctx.Branches+"[/][^/]+[/]")
-			}
-		}
-		regex := fmt.Sprintf("^(?:%s)(?:%s)",
-			strings.Join(patterns, "|"),
-			ctx.Exclude)
-		cmdargs = append(cmdargs,
-			fmt.Sprintf("--ignore-paths=\"%s\"", regex),
-		)
+
+	// the path filters are stored in the git-svn configuration, so later
+	// fetches (e.g. -rebase) apply them as well
+	err = ctx.set_path_filters("svn")
+	if err != nil {
+		return err
 	}
 
 	cmd = exec.Command("git", cmdargs...)
@@ -426,10 +691,24 @@ func (ctx *Context) do_clone() error {
 	return err
 }
 
+// policies for SVN tags which were committed to after their creation
+const (
+	TagsTip    = "tip"    // tag the last commit of the tag
+	TagsSource = "source" // tag the commit the tag was copied from
+	TagsBranch = "branch" // convert the tag into a branch
+)
+
 func (ctx *Context) fix_tags() error {
 	var err error = nil
 	usr := make(map[string]string)
 
+	switch ctx.ModifiedTags {
+	case TagsTip, TagsSource, TagsBranch:
+		// ok
+	default:
+		return fmt.Errorf("invalid '-modified-tags' policy %q", ctx.ModifiedTags)
+	}
+
 	// we only change git config values if ctx.Repo.tags are available.
 	// so it stands to reason we should revert them only in that case.
 	defer func() {
@@ -468,7 +747,7 @@ func (ctx *Context) fix_tags() error {
 		return lines[0], err
 	}
 	usr["user.name"], _ = git_cfg("user.name")
-	usr["user.email"], _ = git_cfg("user.name")
+	usr["user.email"], _ = git_cfg("user.email")
 
 	for itag, tag := range ctx.Repo.tags {
 		tag = strings.Trim(tag, " ")
@@ -480,10 +759,56 @@ func (ctx *Context) fix_tags() error {
 			}
 			fmt.Printf("%s:: processing svn tag [%s]...\n", hdr, tag)
 		}
-		subject := ctx.git_cmd("log", "-1", "--pretty=format:%s", tag)[0]
-		date := ctx.git_cmd("log", "-1", "--pretty=format:%ci", tag)[0]
-		author := ctx.git_cmd("log", "-1", "--pretty=format:%an", tag)[0]
-		email := ctx.git_cmd("log", "-1", "--pretty=format:%ae", tag)[0]
+		// the first commit of a SVN tag is its creation (the copy):
+		// later ones are modifications of the tag.
+		target := tag
+		info := tag
+		entries := ctx.revs.refs[tag]
+		modified := len(entries) - 1
+		if modified < 0 {
+			modified = 0
+		}
+		action := ""
+		if modified > 0 {
+			switch ctx.ModifiedTags {
+			case TagsTip:
+				action = "tagged the tip"
+			case TagsSource:
+				info = entries[0].Commit
+				target = entries[0].Commit
+				if out, err := ctx.git_output("rev-parse", "-q", "--verify", info+"^"); err == nil {
+					target = strings.Trim(string(out), " \r\n")
+				}
+				action = "tagged the copy source"
+			case TagsBranch:
+				action, err = ctx.tag_to_branch(id, tag)
+				if err != nil {
+					return err
+				}
+			}
+			ctx.warn(fmt.Sprintf("tag %s was modified by %d commit(s) after its creation: %s", id, modified, action))
+		}
+		if ctx.ModifiedTags == TagsBranch && modified > 0 {
+			cmd := exec.Command("git", "branch", "-d", "-r", tag)
+			ctx.print_cmd(cmd)
+			err = cmd.Run()
+			if err != nil {
+				return err
+			}
+			ctx.report.Tags = append(ctx.report.Tags, ReportTag{
+				Name:     id,
+				SvnPath:  ctx.svn_rel_path(tag),
+				Revision: entries[len(entries)-1].Rev,
+				Modified: modified,
+				Action:   action,
+			})
+			continue
+		}
+
+		subject := ctx.git_cmd("log", "-1", "--pretty=format:%s", info)[0]
+		date := ctx.git_cmd("log", "-1", "--pretty=format:%ci", info)[0]
+		author := ctx.git_cmd("log", "-1", "--pretty=format:%an", info)[0]
+		email := ctx.git_cmd("log", "-1", "--pretty=format:%ae", info)[0]
 
 		cmd := exec.Command("git", "config", "--local", "user.name",
 			"\""+author+"\"")
@@ -498,7 +823,7 @@ func (ctx *Context) fix_tags() error {
 		cmd = exec.Command("git", "tag", "-a", "-m",
 			fmt.Sprintf("\"%s\"", subject),
 			id,
-			tag)
+			target)
 		cmd.Env = os.Environ()
 		cmd.Env = append(cmd.Env, fmt.Sprintf("GIT_COMMITTER_DATE=%s", date))
 		ctx.print_cmd(cmd)
@@ -508,6 +833,19 @@ func (ctx *Context) fix_tags() error {
 			return err
 		}
 
+		rev := 0
+		sha := strings.Trim(ctx.git_cmd("rev-parse", target)[0], " \r\n")
+		if e, ok := ctx.revs.commit(sha); ok {
+			rev = e.Rev
+		}
+		ctx.report.Tags = append(ctx.report.Tags, ReportTag{
+			Name:     id,
+			SvnPath:  ctx.svn_rel_path(tag),
+			Revision: rev,
+			Modified: modified,
+			Action:   action,
+		})
+
 		cmd = exec.Command("git", "branch", "-d", "-r", tag)
 		ctx.print_cmd(cmd)
 		err = cmd.Run()
@@ -521,6 +859,25 @@ func (ctx *Context) fix_tags() error {
 	return err
 }
 
+// tag_to_branch creates a local branch from the git-svn tag ref (e.g.
+// "svn/tags/1.0") and returns a description of what was done.
+// The branch is named after the tag, unless a SVN branch already has that
+// name.
+func (ctx *Context) tag_to_branch(id, ref string) (string, error) {
+	name := id
+	if is_in_slice(name, ctx.Repo.local_branches) || is_in_slice("svn/"+name, ctx.Repo.remote_branches) {
+		name = "tags/" + id
+	}
+	cmd := exec.Command("git", "branch", name, "remotes/"+ref)
+	ctx.print_cmd(cmd)
+	ctx.debug_cmd(cmd)
+	err := cmd.Run()
+	if err != nil {
+		return "", err
+	}
+	return "converted into branch " + name, nil
+}
+
 func (ctx *Context) fix_branches() error {
 	var err error = nil
 	svn_branches := []string{}
@@ -558,7 +915,7 @@ func (ctx *Context) fix_branches() error {
 		if ctx.Rebase && (is_in_slice(branch, ctx.Repo.local_branches) || branch == "trunk") {
 			lbranch := branch
 			if branch == "trunk" {
-				lbranch = "master"
+				lbranch = ctx.TrunkBranch
 			}
 			cmd := exec.Command("git", "checkout", "-f", lbranch)
 			ctx.print_cmd(cmd)
@@ -580,7 +937,11 @@ func (ctx *Context) fix_branches() error {
 			continue
 		}
 
-		if branch == "trunk" || is_in_slice(branch, ctx.Repo.local_branches) {
+		if branch == "trunk" {
+			continue
+		}
+		if is_in_slice(branch, ctx.Repo.local_branches) {
+			ctx.skip(branch, "a local branch with the same name already exists")
 			continue
 		}
 
@@ -593,6 +954,10 @@ func (ctx *Context) fix_branches() error {
 			return err
 		}
 
+		if ctx.Bare {
+			continue
+		}
+
 		cmd = exec.Command("git", "checkout", branch)
 		ctx.print_cmd(cmd)
 		ctx.debug_cmd(cmd)
@@ -608,20 +973,48 @@ func (ctx *Context) fix_trunk() error {
 	var err error = nil
 	trunk := ""
 	for _, v := range ctx.Repo.remote_branches {
-		if strings.Trim(v, " ") == "trunk" {
+		if strings.Trim(v, " ") == "svn/trunk" {
 			trunk = "trunk"
 			break
 		}
 	}
+	name := ctx.TrunkBranch
+	local := func(branch string) bool {
+		return is_in_slice(branch, ctx.Repo.local_branches)
+	}
+	// depending on its version, git-svn created either 'master' or
+	// whatever HEAD pointed at. drop 'master' unless it is what we want
+	// or it comes from svn.
+	stale_master := name != "master" && local("master") &&
+		!is_in_slice("svn/master", ctx.Repo.remote_branches)
+
 	var cmds []string
-	if trunk != "" && !ctx.Rebase {
-		cmds = []string{
-			"git checkout svn/trunk",
-			"git branch -D master",
-			"git checkout -f -b master",
+	switch {
+	case ctx.Bare:
+		// no working tree: point the trunk branch at trunk and HEAD at it.
+		if trunk != "" {
+			cmds = append(cmds, fmt.Sprintf("git update-ref refs/heads/%s refs/remotes/svn/trunk", name))
+			if stale_master {
+				cmds = append(cmds, "git update-ref -d refs/heads/master")
+			}
+		} else if stale_master && !local(name) {
+			cmds = append(cmds, fmt.Sprintf("git branch -m master %s", name))
 		}
-	} else {
-		cmds = []string{"git checkout -f master"}
+		cmds = append(cmds, fmt.Sprintf("git symbolic-ref HEAD refs/heads/%s", name))
+	case trunk != "" && !ctx.Rebase:
+		cmds = append(cmds, "git checkout svn/trunk")
+		if local(name) {
+			cmds = append(cmds, fmt.Sprintf("git branch -D %s", name))
+		}
+		if stale_master {
+			cmds = append(cmds, "git branch -D master")
+		}
+		cmds = append(cmds, fmt.Sprintf("git checkout -f -b %s", name))
+	default:
+		if !ctx.Rebase && stale_master && !local(name) {
+			cmds = append(cmds, fmt.Sprintf("git branch -m master %s", name))
+		}
+		cmds = append(cmds, fmt.Sprintf("git checkout -f %s", name))
 	}
 	for _, cmdstr := range cmds {
 		cmdargs := strings.Split(cmdstr, " ")
@@ -0,0 +1,129 @@
+package svn
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// new_test_repo creates an empty git repository in a temporary directory,
+// makes it the current directory and returns a quiet Context for it
+func new_test_repo(t *testing.T) *Context {
+	t.Helper()
+	for k, v := range map[string]string{
+		"GIT_AUTHOR_NAME":     "author",
+		"GIT_AUTHOR_EMAIL":    "author@example.com",
+		"GIT_AUTHOR_DATE":     "2001-02-03T04:05:06Z",
+		"GIT_COMMITTER_NAME":  "author",
+		"GIT_COMMITTER_EMAIL": "author@example.com",
+		"GIT_COMMITTER_DATE":  "2001-02-03T04:05:06Z",
+		"GIT_CONFIG_NOSYSTEM": "1",
+		"HOME":                t.TempDir(),
+	} {
+		t.Setenv(k, v)
+	}
+	chdir(t, t.TempDir())
+	run_git(t, "init", "-q", "-b", "master", ".")
+
+	ctx := NewContext("http://svn.example.com/repo")
+	ctx.Verbose = false
+	ctx.report = ctx.new_report()
+	ctx.revs = new_revmap()
+	return ctx
+}
+
+// chdir changes the current directory for the duration of the test
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+// fake_svn puts first in $PATH an "svn" shell script with the given body,
+// which receives the arguments of the svn command line client
+func fake_svn(t *testing.T, body string) {
+	t.Helper()
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "svn"), []byte("#!/bin/sh\n"+body), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// run_git runs git in the current directory and returns its trimmed output
+func run_git(t *testing.T, args ...string) string {
+	t.Helper()
+	out, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// commit_file commits a file with the given content on the current branch
+// and returns the SHA-1 of the commit
+func commit_file(t *testing.T, path, content, msg string) string {
+	t.Helper()
+	if i := strings.LastIndex(path, "/"); i > 0 {
+		err := os.MkdirAll(path[:i], 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := os.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run_git(t, "add", path)
+	run_git(t, "commit", "-q", "-m", msg)
+	return run_git(t, "rev-parse", "HEAD")
+}
+
+func TestNewContextFrom(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	want := NewContext("http://svn.example.com/repo")
+	want.Verbose = false
+	want.Trunk = "Trunk"
+	want.NoTags = true
+
+	ctx := NewContextFrom("http://svn.example.com/repo",
+		false, false, false, false, false, "",
+		"Trunk", "branches", "tags", "", "",
+		false, false, true, "",
+	)
+	if !reflect.DeepEqual(ctx, want) {
+		t.Fatalf("NewContextFrom:\ngot  %+v\nwant %+v", ctx, want)
+	}
+}
+
+func TestRunDryRunOptions(t *testing.T) {
+	for _, setup := range []func(ctx *Context){
+		func(ctx *Context) { ctx.PushRemote = "origin" },
+		func(ctx *Context) { ctx.RevmapFiles = []string{"revmap.csv"} },
+		func(ctx *Context) { ctx.SvnNotes = true },
+		func(ctx *Context) { ctx.RevpropsNotes = true },
+	} {
+		ctx := NewContext("http://svn.example.com/repo")
+		ctx.Verbose = false
+		ctx.RewriteDryRun = true
+		ctx.PruneEmpty = true
+		setup(ctx)
+		_, err := ctx.Run()
+		if err == nil || !strings.Contains(err.Error(), "'-rewrite-dry-run' can not be used") {
+			t.Errorf("got %v, want an error for the incompatible options", err)
+		}
+	}
+}
+
+// EOF
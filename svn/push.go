@@ -0,0 +1,95 @@
+package svn
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// default refspecs used to push the converted repository:
+// only local branches and tags, not the git-svn remote branches.
+var g_push_refspecs = []string{
+	"refs/heads/*:refs/heads/*",
+	"refs/tags/*:refs/tags/*",
+}
+
+// push_repos pushes the converted branches and tags to ctx.PushRemote.
+// Refs rejected by the remote are reported and make push_repos fail.
+func (ctx *Context) push_repos() error {
+	var err error = nil
+	if ctx.PushMirror && len(ctx.PushRefspecs) > 0 {
+		return fmt.Errorf("'-push-mirror' can not be used together with '-push-refspec'")
+	}
+
+	cmdargs := []string{"push", "--porcelain"}
+	if ctx.PushMirror {
+		cmdargs = append(cmdargs, "--mirror", ctx.PushRemote)
+	} else {
+		refspecs := ctx.PushRefspecs
+		if len(refspecs) == 0 {
+			refspecs = g_push_refspecs
+			if ctx.ArchiveDeleted {
+				ns := ctx.archive_namespace()
+				refspecs = append(refspecs[:len(refspecs):len(refspecs)], ns+"*:"+ns+"*")
+			}
+			if ctx.SvnNotes {
+				refspecs = append(refspecs[:len(refspecs):len(refspecs)], g_svn_notes_ref+":"+g_svn_notes_ref)
+			}
+			if ctx.RevpropsNotes {
+				refspecs = append(refspecs[:len(refspecs):len(refspecs)], ctx.RevpropsRef+":"+ctx.RevpropsRef)
+			}
+		}
+		cmdargs = append(cmdargs, ctx.PushRemote)
+		cmdargs = append(cmdargs, refspecs...)
+	}
+
+	cmd := exec.Command("git", cmdargs...)
+	ctx.print_cmd(cmd)
+	stdout := new(bytes.Buffer)
+	cmd.Stdout = stdout
+	if ctx.Verbose {
+		cmd.Stderr = os.Stderr
+	}
+	// git-push exits with a non-zero status when some refs were rejected.
+	// parse its output before deciding what went wrong.
+	err = cmd.Run()
+
+	r := &ctx.report.Push
+	r.Remote = ctx.PushRemote
+	rejected := []string{}
+	scan := bufio.NewScanner(stdout)
+	for scan.Scan() {
+		// porcelain format: <flag> \t <from>:<to> \t <summary>
+		fields := strings.Split(scan.Text(), "\t")
+		if len(fields) < 3 {
+			continue
+		}
+		if ctx.Verbose {
+			fmt.Printf("   %s %s %s\n", fields[0], fields[1], fields[2])
+		}
+		dst := fields[1][strings.LastIndex(fields[1], ":")+1:]
+		if fields[0] == "!" {
+			rejected = append(rejected, fmt.Sprintf("%s %s", fields[1], fields[2]))
+			r.Rejected = append(r.Rejected, fmt.Sprintf("%s %s", dst, strings.TrimPrefix(fields[2], "[rejected] ")))
+		} else {
+			r.Pushed = append(r.Pushed, dst)
+		}
+	}
+
+	if len(rejected) > 0 {
+		fmt.Printf("** %d ref(s) rejected by %q:\n", len(rejected), ctx.PushRemote)
+		for _, ref := range rejected {
+			fmt.Printf("**  %s\n", ref)
+		}
+		return fmt.Errorf("push to %q: %d ref(s) rejected", ctx.PushRemote, len(rejected))
+	}
+	if err != nil {
+		return fmt.Errorf("push to %q: %v", ctx.PushRemote, err)
+	}
+	return err
+}
+
+// EOF
@@ -0,0 +1,105 @@
+package svn
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// new_push_repo returns a Context for a converted repository with a branch,
+// a tag and a git-svn remote branch, and the path of an empty bare remote
+func new_push_repo(t *testing.T) (*Context, string) {
+	ctx := new_test_repo(t)
+	commit_file(t, "a.txt", "a\n", "first")
+	run_git(t, "tag", "-a", "-m", "v1", "v1")
+	run_git(t, "branch", "stable")
+	run_git(t, "update-ref", "refs/remotes/svn/trunk", "HEAD")
+
+	remote := t.TempDir()
+	run_git(t, "init", "-q", "--bare", remote)
+	ctx.PushRemote = remote
+	return ctx, remote
+}
+
+// remote_refs lists the refs of a repository
+func remote_refs(t *testing.T, repo string) []string {
+	out := run_git(t, "--git-dir", repo, "for-each-ref", "--format=%(refname)")
+	refs := strings.Fields(out)
+	sort.Strings(refs)
+	return refs
+}
+
+func TestPushDefaultRefspecs(t *testing.T) {
+	ctx, remote := new_push_repo(t)
+	err := ctx.push_repos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"refs/heads/master", "refs/heads/stable", "refs/tags/v1"}
+	if got := remote_refs(t, remote); !reflect.DeepEqual(got, want) {
+		t.Fatalf("remote refs: got %v, want %v", got, want)
+	}
+	if got := ctx.report.Push.Pushed; !reflect.DeepEqual(got, want) {
+		t.Fatalf("pushed refs: got %v, want %v", got, want)
+	}
+	if len(ctx.report.Push.Rejected) != 0 {
+		t.Fatalf("unexpected rejected refs: %v", ctx.report.Push.Rejected)
+	}
+}
+
+func TestPushRefspecs(t *testing.T) {
+	ctx, remote := new_push_repo(t)
+	ctx.PushRefspecs = []string{"refs/heads/master:refs/heads/main"}
+	err := ctx.push_repos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"refs/heads/main"}
+	if got := remote_refs(t, remote); !reflect.DeepEqual(got, want) {
+		t.Fatalf("remote refs: got %v, want %v", got, want)
+	}
+}
+
+func TestPushMirror(t *testing.T) {
+	ctx, remote := new_push_repo(t)
+	ctx.PushMirror = true
+	err := ctx.push_repos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"refs/heads/master", "refs/heads/stable", "refs/remotes/svn/trunk", "refs/tags/v1"}
+	if got := remote_refs(t, remote); !reflect.DeepEqual(got, want) {
+		t.Fatalf("remote refs: got %v, want %v", got, want)
+	}
+
+	ctx.PushRefspecs = []string{"refs/heads/master"}
+	if err := ctx.push_repos(); err == nil {
+		t.Fatalf("-push-mirror with -push-refspec: expected an error")
+	}
+}
+
+func TestPushRejected(t *testing.T) {
+	ctx, _ := new_push_repo(t)
+	err := ctx.push_repos()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// rewrite master: pushing it again is not a fast-forward
+	run_git(t, "commit", "-q", "--amend", "-m", "rewritten")
+	ctx.report = ctx.new_report()
+	err = ctx.push_repos()
+	if err == nil {
+		t.Fatalf("expected an error for the rejected ref")
+	}
+	want := []string{"refs/heads/master (non-fast-forward)"}
+	if got := ctx.report.Push.Rejected; !reflect.DeepEqual(got, want) {
+		t.Fatalf("rejected refs: got %v, want %v", got, want)
+	}
+	if !is_in_slice("refs/heads/stable", ctx.report.Push.Pushed) {
+		t.Fatalf("refs/heads/stable not reported as pushed: %v", ctx.report.Push.Pushed)
+	}
+}
+
+// EOF
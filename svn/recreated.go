@@ -0,0 +1,118 @@
+package svn
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// policies for the previous incarnations of SVN branches and tags which
+// were deleted and re-created with the same name.
+// git-svn keeps them as "svn/NAME@REV" remote branches, REV being the last
+// revision of the previous incarnation.
+const (
+	RecreatedKeep    = "keep"    // convert them as any other branch or tag
+	RecreatedDrop    = "drop"    // do not convert them
+	RecreatedArchive = "archive" // convert them into branches under archive/
+	RecreatedTag     = "tag"     // convert them into tags
+)
+
+// ReportRecreated describes a previous incarnation of a re-created SVN
+// branch or tag
+type ReportRecreated struct {
+	Ref      string `json:"ref"`      // git-svn remote branch (e.g. "svn/1.x@123")
+	Revision int    `json:"revision"` // last SVN revision of the previous incarnation
+	Action   string `json:"action"`   // what was done with it
+}
+
+var g_recreated_re = regexp.MustCompile(`^svn/(.+)@([0-9]+)$`)
+
+// fix_recreated handles the "svn/NAME@REV" remote branches according to
+// ctx.Recreated, and removes them from the branches and tags to convert
+// unless they are kept.
+func (ctx *Context) fix_recreated() error {
+	var err error = nil
+	switch ctx.Recreated {
+	case RecreatedKeep, RecreatedDrop, RecreatedArchive, RecreatedTag:
+		// ok
+	default:
+		return fmt.Errorf("invalid '-recreated' policy %q", ctx.Recreated)
+	}
+
+	remotes := []string{}
+	for _, ref := range ctx.Repo.remote_branches {
+		m := g_recreated_re.FindStringSubmatch(ref)
+		if m == nil {
+			remotes = append(remotes, ref)
+			continue
+		}
+		name := m[1]
+		rev, _ := strconv.Atoi(m[2])
+
+		action := ""
+		switch ctx.Recreated {
+		case RecreatedKeep:
+			remotes = append(remotes, ref)
+			if strings.HasPrefix(name, "tags/") {
+				action = "kept as tag " + name[len("tags/"):] + "@" + m[2]
+			} else {
+				action = "kept as branch " + name + "@" + m[2]
+			}
+		case RecreatedDrop:
+			action = "dropped"
+			ctx.skip(name+"@"+m[2], fmt.Sprintf("previous incarnation (until r%d) of a re-created SVN branch or tag", rev))
+		case RecreatedArchive:
+			branch := "archive/" + name + "@" + m[2]
+			cmd := exec.Command("git", "branch", branch, "remotes/"+ref)
+			ctx.print_cmd(cmd)
+			ctx.debug_cmd(cmd)
+			err = cmd.Run()
+			if err != nil {
+				return err
+			}
+			action = "archived as branch " + branch
+		case RecreatedTag:
+			tag := strings.TrimPrefix(name, "tags/") + "@" + m[2]
+			cmd := exec.Command("git", "tag", tag, "remotes/"+ref)
+			ctx.print_cmd(cmd)
+			ctx.debug_cmd(cmd)
+			err = cmd.Run()
+			if err != nil {
+				return err
+			}
+			action = "converted into tag " + tag
+		}
+
+		if ctx.Recreated != RecreatedKeep {
+			cmd := exec.Command("git", "branch", "-d", "-r", ref)
+			ctx.print_cmd(cmd)
+			err = cmd.Run()
+			if err != nil {
+				return err
+			}
+		}
+
+		if ctx.Verbose {
+			fmt.Printf(":: re-created svn branch or tag [%s] (previous incarnation until r%d): %s\n", name, rev, action)
+		}
+		ctx.report.Recreated = append(ctx.report.Recreated, ReportRecreated{
+			Ref:      ref,
+			Revision: rev,
+			Action:   action,
+		})
+	}
+	ctx.Repo.remote_branches = remotes
+
+	tags := []string{}
+	for _, tag := range ctx.Repo.tags {
+		if is_in_slice(tag, remotes) {
+			tags = append(tags, tag)
+		}
+	}
+	ctx.Repo.tags = tags
+	return err
+}
+
+// EOF
@@ -0,0 +1,481 @@
+package svn
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Report summarizes a conversion
+type Report struct {
+	Url           string            `json:"url"`            // SVN URL
+	Revisions     string            `json:"revisions"`      // requested revision range (-revision)
+	FirstRevision int               `json:"first_revision"` // first imported SVN revision
+	LastRevision  int               `json:"last_revision"`  // last imported SVN revision
+	Layout        ReportLayout      `json:"layout"`
+	Branches      []ReportBranch    `json:"branches"` // converted branches
+	Tags          []ReportTag       `json:"tags"`     // created tags
+	Skipped       []ReportSkipped   `json:"skipped"`  // SVN branches which were not converted
+	Authors       ReportAuthors     `json:"authors"`
+	Excluded      []string          `json:"excluded"`   // patterns of excluded paths
+	Included      []string          `json:"included"`   // patterns of included paths (-include)
+	PathRules     []string          `json:"path_rules"` // rules moving paths ("SRC=DST")
+	Externals     []ReportExternal  `json:"externals"`
+	Lfs           ReportLfs         `json:"lfs"`
+	Merges        []ReportMerge     `json:"merges"`    // merges found in svn:mergeinfo
+	Recreated     []ReportRecreated `json:"recreated"` // previous incarnations of re-created branches and tags
+	Archived      []ReportArchived  `json:"archived"`  // deleted branches and tags whose history was archived
+	Pruned        map[string]int    `json:"pruned"`    // number of pruned empty commits, per ref
+	RevRefs       ReportRevRefs     `json:"rev_refs"`  // SVN revision references of commit messages
+	Messages      ReportMessages    `json:"messages"`  // cleanup of commit and tag messages
+	Encoding      ReportEncoding    `json:"encoding"`  // commit messages and authors converted to UTF-8
+	Revprops      ReportRevprops    `json:"revprops"`  // SVN revision properties recorded as notes
+	SvnProps      ReportSvnProps    `json:"svnprops"`  // versioned properties recorded in -svnprops files
+	Push          ReportPush        `json:"push"`      // result of -push-to
+	Warnings      []string          `json:"warnings"`  // issues which did not stop the conversion
+	Phases        []ReportPhase     `json:"phases"`
+}
+
+// ReportLayout describes the SVN repository layout used for the conversion
+type ReportLayout struct {
+	RootIsTrunk bool   `json:"root_is_trunk"`
+	Trunk       string `json:"trunk"`
+	Branches    string `json:"branches"`
+	Tags        string `json:"tags"`
+	Subdir      string `json:"subdir,omitempty"` // directory converted as the root of the repository
+}
+
+// ReportBranch describes a converted git branch
+type ReportBranch struct {
+	Name    string `json:"name"`
+	Commits int    `json:"commits"`
+}
+
+// ReportTag describes a git tag created from a SVN tag
+type ReportTag struct {
+	Name     string `json:"name"`
+	SvnPath  string `json:"svn_path"`
+	Revision int    `json:"revision"`
+	Modified int    `json:"modified,omitempty"` // number of commits to the tag after its creation
+	Action   string `json:"action,omitempty"`   // how a modified tag was handled
+}
+
+// ReportSkipped describes a SVN branch which was not converted
+type ReportSkipped struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// ReportAuthors lists the SVN authors found in the history
+type ReportAuthors struct {
+	Mapped   []string `json:"mapped"`   // authors found in the authors file
+	Unmapped []string `json:"unmapped"` // authors missing from the authors file
+}
+
+// ReportPush describes the push of the converted repository
+type ReportPush struct {
+	Remote   string   `json:"remote"`   // URL of the git remote
+	Pushed   []string `json:"pushed"`   // remote refs updated (or already up-to-date)
+	Rejected []string `json:"rejected"` // remote refs rejected, with the reason (e.g. "refs/heads/x (non-fast-forward)")
+}
+
+// ReportPhase records how long a phase of the conversion took
+type ReportPhase struct {
+	Name    string  `json:"name"`
+	Seconds float64 `json:"seconds"`
+}
+
+func (ctx *Context) new_report() *Report {
+	r := &Report{
+		Url:       ctx.Url,
+		Revisions: ctx.Revision,
+		Layout: ReportLayout{
+			RootIsTrunk: ctx.RootIsTrunk,
+			Trunk:       ctx.Trunk,
+			Branches:    ctx.Branches,
+			Tags:        ctx.Tags,
+			Subdir:      ctx.subdir(),
+		},
+		Branches: []ReportBranch{},
+		Tags:     []ReportTag{},
+		Skipped:  []ReportSkipped{},
+		Authors: ReportAuthors{
+			Mapped:   []string{},
+			Unmapped: []string{},
+		},
+		Excluded:  []string{},
+		Included:  []string{},
+		PathRules: []string{},
+		Externals: []ReportExternal{},
+		Merges:    []ReportMerge{},
+		Recreated: []ReportRecreated{},
+		Archived:  []ReportArchived{},
+		Pruned:    make(map[string]int),
+		Revprops: ReportRevprops{
+			Names: []string{},
+		},
+		SvnProps: ReportSvnProps{
+			Branches: []string{},
+			Names:    []string{},
+		},
+		Encoding: ReportEncoding{
+			Transcoded:  []int{},
+			Undecodable: []int{},
+		},
+		Push: ReportPush{
+			Pushed:   []string{},
+			Rejected: []string{},
+		},
+		Warnings: []string{},
+		Phases:   []ReportPhase{},
+	}
+	r.Excluded = append(r.Excluded, ctx.excludes()...)
+	r.Included = append(r.Included, ctx.Includes...)
+	r.PathRules = append(r.PathRules, ctx.PathRules...)
+	return r
+}
+
+// run_phase runs fct and records its duration in the report
+func (ctx *Context) run_phase(name string, fct func() error) error {
+	start := time.Now()
+	err := fct()
+	ctx.report.Phases = append(ctx.report.Phases, ReportPhase{
+		Name:    name,
+		Seconds: time.Since(start).Seconds(),
+	})
+	return err
+}
+
+// skip records a SVN branch which was not converted
+func (ctx *Context) skip(name, reason string) {
+	if ctx.Verbose {
+		fmt.Printf("-- skip [%s]: %s\n", name, reason)
+	}
+	ctx.report.Skipped = append(ctx.report.Skipped, ReportSkipped{
+		Name:   name,
+		Reason: reason,
+	})
+}
+
+// warn records an issue which does not stop the conversion
+func (ctx *Context) warn(msg string) {
+	fmt.Printf("** warning: %s\n", msg)
+	ctx.report.Warnings = append(ctx.report.Warnings, msg)
+}
+
+// fill_report completes the report with the final state of the repository
+func (ctx *Context) fill_report() error {
+	r := ctx.report
+
+	for _, entries := range ctx.revs.refs {
+		if len(entries) == 0 {
+			continue
+		}
+		if r.FirstRevision == 0 || entries[0].Rev < r.FirstRevision {
+			r.FirstRevision = entries[0].Rev
+		}
+		if last := entries[len(entries)-1].Rev; last > r.LastRevision {
+			r.LastRevision = last
+		}
+	}
+
+	branches, err := ctx.list_refs("refs/heads/")
+	if err != nil {
+		return err
+	}
+	for _, branch := range branches {
+		out, err := ctx.git_output("rev-list", "--count", "refs/heads/"+branch)
+		if err != nil {
+			return err
+		}
+		n, err := strconv.Atoi(strings.Trim(string(out), " \r\n"))
+		if err != nil {
+			return err
+		}
+		r.Branches = append(r.Branches, ReportBranch{Name: branch, Commits: n})
+	}
+
+	return ctx.report_authors()
+}
+
+// git-svn uses "user <user@repository-uuid>" for authors it could not map
+var g_unmapped_author_re = regexp.MustCompile(`^(.*)@[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// report_authors lists the mapped and unmapped SVN authors of the history
+func (ctx *Context) report_authors() error {
+	// reverse mapping of the authors file: "Name <email>" -> svn user
+	users := make(map[string]string)
+	if ctx.Authors != "" {
+		f, err := os.Open(ctx.Authors)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		scan := bufio.NewScanner(f)
+		for scan.Scan() {
+			line := strings.Trim(scan.Text(), " \t\r")
+			i := strings.Index(line, "=")
+			if i < 0 || strings.HasPrefix(line, "#") {
+				continue
+			}
+			user := strings.Trim(line[:i], " \t")
+			ident := strings.Trim(line[i+1:], " \t")
+			users[ident] = user
+		}
+		err = scan.Err()
+		if err != nil {
+			return err
+		}
+	}
+
+	out, err := ctx.git_output("log", "--all", "--format=%an <%ae>")
+	if err != nil {
+		return err
+	}
+	mapped := make(map[string]bool)
+	unmapped := make(map[string]bool)
+	for _, ident := range strings.Split(string(out), "\n") {
+		ident = strings.Trim(ident, " \r")
+		if ident == "" {
+			continue
+		}
+		if user, ok := users[ident]; ok {
+			mapped[user] = true
+			continue
+		}
+		email := ident[strings.LastIndex(ident, "<")+1 : len(ident)-1]
+		if m := g_unmapped_author_re.FindStringSubmatch(email); m != nil {
+			unmapped[m[1]] = true
+			continue
+		}
+		// mapped by other means (e.g. svn.authorsProg)
+		mapped[ident] = true
+	}
+	for user := range mapped {
+		ctx.report.Authors.Mapped = append(ctx.report.Authors.Mapped, user)
+	}
+	for user := range unmapped {
+		ctx.report.Authors.Unmapped = append(ctx.report.Authors.Unmapped, user)
+	}
+	sort.Strings(ctx.report.Authors.Mapped)
+	sort.Strings(ctx.report.Authors.Unmapped)
+	return nil
+}
+
+// Save writes the report to fname, in JSON or Markdown format depending on
+// the file extension (.json, .md)
+func (r *Report) Save(fname string) error {
+	var write func(io.Writer) error
+	switch strings.ToLower(filepath.Ext(fname)) {
+	case ".json":
+		write = r.WriteJSON
+	case ".md", ".markdown":
+		write = r.WriteMarkdown
+	default:
+		return fmt.Errorf("unknown report format for %q (want .json or .md)", fname)
+	}
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	err = write(f)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// WriteJSON writes the report in JSON format
+func (r *Report) WriteJSON(w io.Writer) error {
+	buf, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(buf, '\n'))
+	return err
+}
+
+// WriteMarkdown writes the report in Markdown format
+func (r *Report) WriteMarkdown(w io.Writer) error {
+	o := bufio.NewWriter(w)
+	p := func(format string, args ...interface{}) {
+		fmt.Fprintf(o, format, args...)
+	}
+	list := func(title string, items []string) {
+		p("\n## %s\n\n", title)
+		if len(items) == 0 {
+			p("_none_\n")
+			return
+		}
+		for _, item := range items {
+			p("- `%s`\n", item)
+		}
+	}
+
+	p("# go-svn2git migration report\n\n")
+	p("- SVN URL: %s\n", r.Url)
+	if r.Revisions != "" {
+		p("- requested revisions: %s\n", r.Revisions)
+	}
+	p("- imported revisions: r%d to r%d\n", r.FirstRevision, r.LastRevision)
+	if r.Layout.RootIsTrunk {
+		p("- layout: root is trunk\n")
+	} else {
+		p("- layout: trunk=%q branches=%q tags=%q\n",
+			r.Layout.Trunk, r.Layout.Branches, r.Layout.Tags)
+	}
+	if r.Layout.Subdir != "" {
+		p("- converted directory: %s\n", r.Layout.Subdir)
+	}
+
+	p("\n## Branches\n\n")
+	p("| branch | commits |\n|---|---:|\n")
+	for _, b := range r.Branches {
+		p("| `%s` | %d |\n", b.Name, b.Commits)
+	}
+
+	p("\n## Tags\n\n")
+	p("| tag | SVN path | revision | commits after creation |\n|---|---|---:|---|\n")
+	for _, t := range r.Tags {
+		modified := "-"
+		if t.Modified > 0 {
+			modified = fmt.Sprintf("%d (%s)", t.Modified, t.Action)
+		}
+		p("| `%s` | `%s` | r%d | %s |\n", t.Name, t.SvnPath, t.Revision, modified)
+	}
+
+	p("\n## Skipped branches\n\n")
+	if len(r.Skipped) == 0 {
+		p("_none_\n")
+	}
+	for _, s := range r.Skipped {
+		p("- `%s`: %s\n", s.Name, s.Reason)
+	}
+
+	if len(r.Recreated) > 0 {
+		p("\n## Re-created branches and tags\n\n")
+		p("| git-svn ref | previous incarnation until | action |\n|---|---:|---|\n")
+		for _, rc := range r.Recreated {
+			p("| `%s` | r%d | %s |\n", rc.Ref, rc.Revision, rc.Action)
+		}
+	}
+
+	if len(r.Archived) > 0 {
+		p("\n## Archived deleted branches and tags\n\n")
+		p("| SVN path | created | deleted | git ref |\n|---|---:|---:|---|\n")
+		for _, a := range r.Archived {
+			p("| `%s` | r%d | r%d | `%s` |\n", a.SvnPath, a.Created, a.Deleted, a.Ref)
+		}
+	}
+
+	list("Mapped authors", r.Authors.Mapped)
+	list("Unmapped authors", r.Authors.Unmapped)
+	list("Excluded paths", r.Excluded)
+	if len(r.Included) > 0 {
+		list("Included paths", r.Included)
+	}
+	if len(r.PathRules) > 0 {
+		list("Moved paths", r.PathRules)
+	}
+
+	if len(r.Externals) > 0 {
+		p("\n## svn:externals\n\n")
+		p("| branch | path | URL | revision | action |\n|---|---|---|---:|---|\n")
+		for _, ext := range r.Externals {
+			rev := "HEAD"
+			if ext.Revision > 0 {
+				rev = fmt.Sprintf("r%d", ext.Revision)
+			}
+			p("| `%s` | `%s` | %s | %s | %s |\n", ext.Branch, ext.Path, ext.Url, rev, ext.Action)
+		}
+	}
+
+	if r.Lfs.Objects > 0 {
+		p("\n## Git LFS\n\n")
+		p("- objects: %d\n- bytes moved to LFS: %d\n", r.Lfs.Objects, r.Lfs.Bytes)
+	}
+
+	if len(r.Merges) > 0 {
+		p("\n## SVN merges\n\n")
+		p("| branch | revision | source | merged revisions | action |\n|---|---:|---|---|---|\n")
+		for _, m := range r.Merges {
+			p("| `%s` | r%d | `%s` | %s | %s |\n", m.Branch, m.Revision, m.Source, m.Revisions, m.Action)
+		}
+	}
+
+	if len(r.Pruned) > 0 {
+		p("\n## Pruned empty commits\n\n")
+		p("| ref | commits |\n|---|---:|\n")
+		refs := make([]string, 0, len(r.Pruned))
+		for ref := range r.Pruned {
+			refs = append(refs, ref)
+		}
+		sort.Strings(refs)
+		for _, ref := range refs {
+			p("| `%s` | %d |\n", ref, r.Pruned[ref])
+		}
+	}
+
+	if len(r.Encoding.Transcoded) > 0 || len(r.Encoding.Undecodable) > 0 {
+		p("\n## Encoding\n\n")
+		p("Commit messages and authors which were not valid UTF-8 were decoded from %s.\n\n", r.Encoding.Encoding)
+		p("- transcoded revisions: %s\n", format_revisions(r.Encoding.Transcoded))
+		p("- revisions with undecodable bytes (replaced by U+FFFD): %s\n", format_revisions(r.Encoding.Undecodable))
+	}
+
+	if r.Revprops.Commits > 0 {
+		p("\n## SVN revision properties\n\n")
+		p("- notes ref: `%s`\n- revisions: %d\n- commits: %d\n", r.Revprops.Ref, r.Revprops.Revisions, r.Revprops.Commits)
+		p("- properties: `%s`\n", strings.Join(r.Revprops.Names, "`, `"))
+	}
+
+	if len(r.SvnProps.Branches) > 0 {
+		p("\n## SVN versioned properties\n\n")
+		p("- file: `%s`\n- branches: %s\n- paths: %d\n", r.SvnProps.File, strings.Join(r.SvnProps.Branches, ", "), r.SvnProps.Paths)
+		p("- properties: `%s`\n", strings.Join(r.SvnProps.Names, "`, `"))
+	}
+
+	if r.Messages.Rewritten > 0 {
+		p("\n## Commit messages\n\n")
+		p("- rewritten: %d\n- empty messages replaced: %d\n", r.Messages.Rewritten, r.Messages.Empty)
+	}
+
+	if r.RevRefs.Rewritten > 0 || r.RevRefs.Unresolved > 0 {
+		p("\n## SVN revision references\n\n")
+		p("- rewritten: %d\n- unresolved (left as is): %d\n", r.RevRefs.Rewritten, r.RevRefs.Unresolved)
+	}
+
+	if r.Push.Remote != "" {
+		p("\n## Push\n\n")
+		p("- remote: %s\n- pushed refs: %d\n", r.Push.Remote, len(r.Push.Pushed))
+		for _, ref := range r.Push.Rejected {
+			p("- rejected: `%s`\n", ref)
+		}
+	}
+
+	if len(r.Warnings) > 0 {
+		p("\n## Warnings\n\n")
+		for _, msg := range r.Warnings {
+			p("- %s\n", msg)
+		}
+	}
+
+	p("\n## Phases\n\n")
+	p("| phase | elapsed |\n|---|---:|\n")
+	for _, phase := range r.Phases {
+		p("| %s | %.1fs |\n", phase.Name, phase.Seconds)
+	}
+
+	return o.Flush()
+}
+
+// EOF
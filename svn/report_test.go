@@ -0,0 +1,37 @@
+package svn
+
+import (
+	"testing"
+)
+
+func TestReportTagSvnPath(t *testing.T) {
+	ctx := new_test_repo(t)
+	ctx.Tags = "releases"
+	ctx.Subdir = "lib"
+	c1 := commit_file(t, "a.txt", "a\n", "r3")
+	c2 := commit_file(t, "a.txt", "b\n", "r5")
+	run_git(t, "update-ref", "refs/remotes/svn/tags/1.0", c1)
+	run_git(t, "update-ref", "refs/remotes/svn/tags/1.0@4", c2)
+	ctx.revs.add(rev_entry{Rev: 3, Ref: "svn/tags/1.0", Commit: c1})
+	ctx.revs.add(rev_entry{Rev: 5, Ref: "svn/tags/1.0@4", Commit: c2})
+	ctx.Repo.tags = []string{"svn/tags/1.0", "svn/tags/1.0@4"}
+
+	err := ctx.fix_tags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"1.0":   "releases/1.0/lib",
+		"1.0@4": "releases/1.0/lib",
+	}
+	if len(ctx.report.Tags) != len(want) {
+		t.Fatalf("got %d tag(s), want %d", len(ctx.report.Tags), len(want))
+	}
+	for _, tag := range ctx.report.Tags {
+		if tag.SvnPath != want[tag.Name] {
+			t.Errorf("tag %s: got svn path %q, want %q", tag.Name, tag.SvnPath, want[tag.Name])
+		}
+	}
+}
+
+// EOF
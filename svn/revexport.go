@@ -0,0 +1,310 @@
+package svn
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// notes ref holding the SVN revision of each commit
+const g_svn_notes_ref = "refs/notes/svn"
+
+// RevisionEntry associates a SVN revision with the git commit converted
+// from it
+type RevisionEntry struct {
+	Revision int    `json:"revision"`
+	Commit   string `json:"commit"`
+	SvnPath  string `json:"svn_path"` // branch path relative to the repository URL (e.g. "branches/1.x")
+}
+
+// revision_entries returns the entries of m, sorted by revision
+func (ctx *Context) revision_entries(m *revmap) []RevisionEntry {
+	entries := []RevisionEntry{}
+	for ref, refs := range m.refs {
+		path := ctx.svn_rel_path(ref)
+		for _, e := range refs {
+			entries = append(entries, RevisionEntry{
+				Revision: e.Rev,
+				Commit:   e.Commit,
+				SvnPath:  path,
+			})
+		}
+	}
+	sort.Sort(revision_entries(entries))
+	return entries
+}
+
+// export_revmap writes the SVN revision <-> git commit mapping to the
+// ctx.RevmapFiles, and to git notes under refs/notes/svn if ctx.SvnNotes
+// is set
+func (ctx *Context) export_revmap() error {
+	var err error = nil
+	entries := ctx.revision_entries(ctx.revs)
+	for _, fname := range ctx.RevmapFiles {
+		err = save_revision_entries(fname, entries)
+		if err != nil {
+			return err
+		}
+		if ctx.Verbose {
+			fmt.Printf(":: wrote %d revisions to %s\n", len(entries), fname)
+		}
+	}
+	if ctx.SvnNotes {
+		err = ctx.write_svn_notes(entries)
+	}
+	return err
+}
+
+// save_revision_entries writes entries to fname, in CSV or JSON format
+// depending on the file extension (.csv, .json)
+func save_revision_entries(fname string, entries []RevisionEntry) error {
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	switch strings.ToLower(filepath.Ext(fname)) {
+	case ".csv":
+		w := csv.NewWriter(f)
+		w.Write([]string{"revision", "commit", "svn_path"})
+		for _, e := range entries {
+			w.Write([]string{strconv.Itoa(e.Revision), e.Commit, e.SvnPath})
+		}
+		w.Flush()
+		err = w.Error()
+	case ".json":
+		var buf []byte
+		buf, err = json.MarshalIndent(entries, "", "  ")
+		if err == nil {
+			_, err = f.Write(append(buf, '\n'))
+		}
+	default:
+		return fmt.Errorf("unknown revision map format for %q (want .csv or .json)", fname)
+	}
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// load_revision_entries reads a file written by save_revision_entries
+func load_revision_entries(fname string) ([]RevisionEntry, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entries := []RevisionEntry{}
+	switch strings.ToLower(filepath.Ext(fname)) {
+	case ".csv":
+		records, err := csv.NewReader(f).ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fname, err)
+		}
+		for i, rec := range records {
+			if i == 0 && rec[0] == "revision" {
+				continue
+			}
+			if len(rec) != 3 {
+				return nil, fmt.Errorf("%s:%d: invalid record", fname, i+1)
+			}
+			rev, err := strconv.Atoi(rec[0])
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid revision %q", fname, i+1, rec[0])
+			}
+			entries = append(entries, RevisionEntry{Revision: rev, Commit: rec[1], SvnPath: rec[2]})
+		}
+	case ".json":
+		err = json.NewDecoder(f).Decode(&entries)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fname, err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown revision map format for %q (want .csv or .json)", fname)
+	}
+	return entries, nil
+}
+
+// write_svn_notes attaches to each converted commit a note listing its
+// SVN revision(s), under refs/notes/svn
+func (ctx *Context) write_svn_notes(entries []RevisionEntry) error {
+	notes := make(map[string]string)
+	commits := []string{}
+	for _, e := range entries {
+		if _, ok := notes[e.Commit]; !ok {
+			commits = append(commits, e.Commit)
+		}
+		notes[e.Commit] += fmt.Sprintf("SVN-Revision: r%d\nSVN-Path: %s\n", e.Revision, e.SvnPath)
+	}
+	err := ctx.write_notes(g_svn_notes_ref, "Record SVN revisions\n", commits, notes)
+	if err == nil && ctx.Verbose {
+		fmt.Printf(":: recorded the SVN revisions of %d commits in %s\n", len(commits), g_svn_notes_ref)
+	}
+	return err
+}
+
+// write_notes adds (or replaces) the notes of commits under the notes ref,
+// in a single notes commit with the message msg
+func (ctx *Context) write_notes(ref, msg string, commits []string, notes map[string]string) error {
+	cmd := exec.Command("git", "fast-import", "--quiet")
+	ctx.print_cmd(cmd)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(stdin)
+	fmt.Fprintf(w, "commit %s\n", ref)
+	fmt.Fprintf(w, "committer go-svn2git <go-svn2git@localhost> %d +0000\n", time.Now().Unix())
+	fmt.Fprintf(w, "data %d\n%s\n", len(msg), msg)
+	if ctx.ref_exists(ref) {
+		fmt.Fprintf(w, "from %s^0\n", ref)
+	}
+	for _, commit := range commits {
+		note := notes[commit]
+		fmt.Fprintf(w, "N inline %s\ndata %d\n%s\n", commit, len(note), note)
+	}
+	err = w.Flush()
+	stdin.Close()
+	if err1 := cmd.Wait(); err == nil && err1 != nil {
+		err = fmt.Errorf("git fast-import: %v", err1)
+	}
+	return err
+}
+
+var g_svn_note_re = regexp.MustCompile(`(?m)^SVN-Revision: r([0-9]+)\nSVN-Path: (.*)$`)
+
+// read_svn_notes reads the revision entries recorded under refs/notes/svn
+func (ctx *Context) read_svn_notes() ([]RevisionEntry, error) {
+	out, err := ctx.git_output("notes", "--ref="+g_svn_notes_ref, "list")
+	if err != nil {
+		return nil, err
+	}
+	cat, err := ctx.new_git_catfile()
+	if err != nil {
+		return nil, err
+	}
+	defer cat.close()
+
+	entries := []RevisionEntry{}
+	for _, line := range strings.Split(string(out), "\n") {
+		// <note blob> SP <annotated commit>
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		note, err := cat.read(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range g_svn_note_re.FindAllStringSubmatch(string(note), -1) {
+			rev, _ := strconv.Atoi(m[1])
+			entries = append(entries, RevisionEntry{Revision: rev, Commit: fields[1], SvnPath: m[2]})
+		}
+	}
+	sort.Sort(revision_entries(entries))
+	return entries, nil
+}
+
+// lookup_entries returns the best available SVN revision <-> git commit
+// mapping: the exported mapping files if any, else the refs/notes/svn
+// notes, else the git-svn metadata.
+// Unlike the git-svn metadata, the former two follow history rewrites.
+func (ctx *Context) lookup_entries() ([]RevisionEntry, error) {
+	switch {
+	case len(ctx.RevmapFiles) > 0:
+		entries := []RevisionEntry{}
+		for _, fname := range ctx.RevmapFiles {
+			e, err := load_revision_entries(fname)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, e...)
+		}
+		sort.Sort(revision_entries(entries))
+		return entries, nil
+	case ctx.ref_exists(g_svn_notes_ref):
+		return ctx.read_svn_notes()
+	}
+	m, err := ctx.load_revmap()
+	if err != nil {
+		return nil, err
+	}
+	return ctx.revision_entries(m), nil
+}
+
+// lookup_revmap returns the mapping of lookup_entries as a revmap
+func (ctx *Context) lookup_revmap() (*revmap, error) {
+	entries, err := ctx.lookup_entries()
+	if err != nil {
+		return nil, err
+	}
+	m := new_revmap()
+	for _, e := range entries {
+		m.add(rev_entry{Rev: e.Revision, Ref: ctx.svn_ref(e.SvnPath), Commit: e.Commit})
+	}
+	m.sort()
+	return m, nil
+}
+
+// Lookup prints the git commits converted from SVN revisions ("r1234" or
+// "1234"), or the SVN revisions of git commits (SHA-1 or SHA-1 prefix).
+// An error is returned if a query has no answer.
+func (ctx *Context) Lookup(queries []string) error {
+	entries, err := ctx.lookup_entries()
+	if err != nil {
+		return err
+	}
+
+	missing := []string{}
+	for _, q := range queries {
+		found := false
+		rev, rerr := strconv.Atoi(strings.TrimPrefix(q, "r"))
+		for _, e := range entries {
+			match := false
+			if rerr == nil {
+				match = e.Revision == rev
+			} else {
+				match = len(q) >= 4 && strings.HasPrefix(e.Commit, strings.ToLower(q))
+			}
+			if match {
+				fmt.Printf("r%d %s %s\n", e.Revision, e.Commit, e.SvnPath)
+				found = true
+			}
+		}
+		if !found {
+			missing = append(missing, q)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("no match for %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+type revision_entries []RevisionEntry
+
+func (p revision_entries) Len() int { return len(p) }
+func (p revision_entries) Less(i, j int) bool {
+	if p[i].Revision != p[j].Revision {
+		return p[i].Revision < p[j].Revision
+	}
+	return p[i].SvnPath < p[j].SvnPath
+}
+func (p revision_entries) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+
+// EOF
@@ -0,0 +1,157 @@
+package svn
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// rev_entry associates a SVN revision with the git commit git-svn created for it
+type rev_entry struct {
+	Rev    int    // SVN revision number
+	Ref    string // git-svn remote branch (e.g. "svn/trunk", "svn/tags/1.0")
+	Commit string // git commit SHA-1
+}
+
+// revmap holds the SVN revision <-> git commit mapping of a repository
+type revmap struct {
+	refs    map[string][]rev_entry // entries per git-svn ref, sorted by revision
+	commits map[string]rev_entry   // entries per git commit
+}
+
+func new_revmap() *revmap {
+	return &revmap{
+		refs:    make(map[string][]rev_entry),
+		commits: make(map[string]rev_entry),
+	}
+}
+
+func (m *revmap) add(e rev_entry) {
+	m.refs[e.Ref] = append(m.refs[e.Ref], e)
+	m.set_commit(e)
+}
+
+// set_commit records e as the entry of its commit, unless the commit has an
+// entry of a lower revision already.
+// Several revisions share a commit once the empty commits were pruned:
+// those of the dropped commits (including the creations of tags and
+// branches, on other refs) are merged into the previous commit, whose own
+// revision is the lowest one.
+func (m *revmap) set_commit(e rev_entry) {
+	if o, ok := m.commits[e.Commit]; ok {
+		if o.Rev < e.Rev || (o.Rev == e.Rev && o.Ref <= e.Ref) {
+			return
+		}
+	}
+	m.commits[e.Commit] = e
+}
+
+// sort sorts the entries of each ref by revision
+func (m *revmap) sort() {
+	for _, entries := range m.refs {
+		sort.Sort(rev_entries(entries))
+	}
+}
+
+// commit returns the entry of the git commit sha, if any
+func (m *revmap) commit(sha string) (rev_entry, bool) {
+	e, ok := m.commits[sha]
+	return e, ok
+}
+
+// rewrite updates the mapping after the history was rewritten.
+// mapping associates original commits with rewritten ones; entries whose
+// commit was dropped without replacement ("") are removed.
+func (m *revmap) rewrite(mapping map[string]string) {
+	m.commits = make(map[string]rev_entry, len(m.commits))
+	for ref, entries := range m.refs {
+		kept := entries[:0]
+		for _, e := range entries {
+			if sha, ok := mapping[e.Commit]; ok {
+				if sha == "" {
+					continue
+				}
+				e.Commit = sha
+			}
+			kept = append(kept, e)
+			m.set_commit(e)
+		}
+		m.refs[ref] = kept
+	}
+}
+
+type rev_entries []rev_entry
+
+func (p rev_entries) Len() int           { return len(p) }
+func (p rev_entries) Less(i, j int) bool { return p[i].Rev < p[j].Rev }
+func (p rev_entries) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// git_dir returns the path to the .git directory of the current repository
+func (ctx *Context) git_dir() string {
+	lines := ctx.git_cmd("rev-parse", "--git-dir")
+	if len(lines) == 0 {
+		return ".git"
+	}
+	return strings.Trim(lines[0], " \r\n")
+}
+
+// load_revmap reads the .rev_map files git-svn maintains under
+// $GIT_DIR/svn/refs/remotes.
+// These files are a sequence of 24-byte records: a 4-byte big-endian
+// revision number followed by the 20-byte binary commit SHA-1.
+// They are available whether or not git-svn-id lines were recorded.
+func (ctx *Context) load_revmap() (*revmap, error) {
+	m := new_revmap()
+	root := filepath.Join(ctx.git_dir(), "svn", "refs", "remotes")
+	if !path_exists(root) {
+		return m, nil
+	}
+	err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() || !strings.HasPrefix(fi.Name(), ".rev_map.") {
+			return nil
+		}
+		rel, err := filepath.Rel(root, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		// git-svn escapes unusual characters of ref names as %XX
+		ref, err := url.PathUnescape(filepath.ToSlash(rel))
+		if err != nil {
+			ref = filepath.ToSlash(rel)
+		}
+		buf, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		const reclen = 4 + 20
+		for i := 0; i+reclen <= len(buf); i += reclen {
+			rec := buf[i : i+reclen]
+			sha := hex.EncodeToString(rec[4:])
+			if strings.Trim(sha, "0") == "" {
+				// padding record for a revision without commit
+				continue
+			}
+			m.add(rev_entry{
+				Rev:    int(binary.BigEndian.Uint32(rec[:4])),
+				Ref:    ref,
+				Commit: sha,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	m.sort()
+	return m, nil
+}
+
+// EOF
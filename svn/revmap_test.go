@@ -0,0 +1,55 @@
+package svn
+
+import (
+	"testing"
+)
+
+func TestRevmapRewrite(t *testing.T) {
+	// r2 and r3 were pruned into the commit of r1, the creation of tag 1.0
+	// (r4) too; r5 was dropped without replacement
+	mapping := map[string]string{
+		"c1": "n1",
+		"c2": "n1",
+		"c3": "n1",
+		"c4": "n1",
+		"c5": "",
+		"c6": "n6",
+	}
+	for i := 0; i < 20; i++ {
+		m := new_revmap()
+		m.add(rev_entry{Rev: 1, Ref: "svn/trunk", Commit: "c1"})
+		m.add(rev_entry{Rev: 2, Ref: "svn/trunk", Commit: "c2"})
+		m.add(rev_entry{Rev: 3, Ref: "svn/trunk", Commit: "c3"})
+		m.add(rev_entry{Rev: 4, Ref: "svn/tags/1.0", Commit: "c4"})
+		m.add(rev_entry{Rev: 5, Ref: "svn/1.x", Commit: "c5"})
+		m.add(rev_entry{Rev: 6, Ref: "svn/1.x", Commit: "c6"})
+		m.rewrite(mapping)
+
+		want := rev_entry{Rev: 1, Ref: "svn/trunk", Commit: "n1"}
+		if e, ok := m.commit("n1"); !ok || e != want {
+			t.Fatalf("commit(n1): got %+v, want %+v", e, want)
+		}
+		if e, ok := m.commit("n6"); !ok || e.Rev != 6 {
+			t.Fatalf("commit(n6): got %+v", e)
+		}
+		if n := len(m.refs["svn/trunk"]); n != 3 {
+			t.Fatalf("svn/trunk: got %d entries, want 3", n)
+		}
+		if n := len(m.refs["svn/1.x"]); n != 1 {
+			t.Fatalf("svn/1.x: got %d entries, want 1", n)
+		}
+	}
+}
+
+func TestRevmapSetCommit(t *testing.T) {
+	m := new_revmap()
+	m.add(rev_entry{Rev: 7, Ref: "svn/trunk", Commit: "c"})
+	m.add(rev_entry{Rev: 3, Ref: "svn/tags/1.0", Commit: "c"})
+	m.add(rev_entry{Rev: 3, Ref: "svn/1.x", Commit: "c"})
+	want := rev_entry{Rev: 3, Ref: "svn/1.x", Commit: "c"}
+	if e, _ := m.commit("c"); e != want {
+		t.Fatalf("commit(c): got %+v, want %+v", e, want)
+	}
+}
+
+// EOF
@@ -0,0 +1,171 @@
+package svn
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// formats of the notes recording SVN revision properties
+const (
+	RevpropsText = "text" // "name: value" lines, continuation lines indented by a space
+	RevpropsJSON = "json" // a JSON array of revision_props
+)
+
+// default notes ref of the SVN revision properties
+const g_revprops_ref = "refs/notes/svn-revprops"
+
+// revision properties set by SVN itself, which git records already
+var g_std_revprops = []string{"svn:log", "svn:author", "svn:date"}
+
+// ReportRevprops summarizes the SVN revision properties recorded as notes
+type ReportRevprops struct {
+	Ref       string   `json:"ref"`       // notes ref
+	Revisions int      `json:"revisions"` // revisions with non-standard properties
+	Commits   int      `json:"commits"`   // commits annotated
+	Names     []string `json:"names"`     // names of the properties found
+}
+
+// revision_props holds the non-standard properties of a revision
+type revision_props struct {
+	Revision   int               `json:"revision"`
+	Properties map[string]string `json:"properties"`
+}
+
+// svn_revprops returns the non-standard revision properties of the
+// revisions of ctx.Url, indexed by revision
+func (ctx *Context) svn_revprops() (map[int]map[string]string, error) {
+	out, err := ctx.svn_cmd("log", "--xml", "-q", "--with-all-revprops", "-r", "1:HEAD", ctx.Url+"@HEAD")
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		Entries []struct {
+			Rev   int `xml:"revision,attr"`
+			Props []struct {
+				Name  string `xml:"name,attr"`
+				Value string `xml:",chardata"`
+			} `xml:"revprops>property"`
+		} `xml:"logentry"`
+	}
+	err = xml.Unmarshal(out, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse log of %s: %v", ctx.Url, err)
+	}
+	props := make(map[int]map[string]string)
+	for _, e := range doc.Entries {
+		for _, p := range e.Props {
+			if is_in_slice(p.Name, g_std_revprops) {
+				continue
+			}
+			if props[e.Rev] == nil {
+				props[e.Rev] = make(map[string]string)
+			}
+			props[e.Rev][p.Name] = p.Value
+		}
+	}
+	return props, nil
+}
+
+// format_revprops formats the properties of the revisions converted into a
+// commit as a note. In text format, the properties of each revision are
+// separated by an empty line.
+func format_revprops(revs []revision_props, format string) (string, error) {
+	if format == RevpropsJSON {
+		buf, err := json.MarshalIndent(revs, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(buf) + "\n", nil
+	}
+	note := ""
+	for i, rp := range revs {
+		if i > 0 {
+			note += "\n"
+		}
+		names := make([]string, 0, len(rp.Properties))
+		for name := range rp.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			value := strings.TrimRight(rp.Properties[name], "\n")
+			note += name + ": " + strings.Replace(value, "\n", "\n ", -1) + "\n"
+		}
+	}
+	return note, nil
+}
+
+// record_revprops attaches the non-standard SVN revision properties of each
+// converted revision to its commit, as a note under ctx.RevpropsRef
+func (ctx *Context) record_revprops() error {
+	switch ctx.RevpropsFormat {
+	case RevpropsText, RevpropsJSON:
+		// ok
+	default:
+		return fmt.Errorf("invalid '-revprops-format' %q (want text or json)", ctx.RevpropsFormat)
+	}
+	ref := ctx.RevpropsRef
+	if !strings.HasPrefix(ref, "refs/notes/") {
+		return fmt.Errorf("invalid '-revprops-ref' %q (must start with refs/notes/)", ref)
+	}
+
+	props, err := ctx.svn_revprops()
+	if err != nil {
+		return err
+	}
+
+	r := &ctx.report.Revprops
+	r.Ref = ref
+	names := make(map[string]bool)
+	recorded := make(map[int]bool)
+	revs := make(map[string][]revision_props) // commit -> revisions, in order
+	commits := []string{}
+	for _, e := range ctx.revision_entries(ctx.revs) {
+		p, ok := props[e.Revision]
+		if !ok {
+			continue
+		}
+		// several revisions may be converted into the same commit (e.g.
+		// with -prune-empty), and a revision into several commits
+		prev, seen := revs[e.Commit]
+		if !seen {
+			commits = append(commits, e.Commit)
+		} else if prev[len(prev)-1].Revision == e.Revision {
+			continue
+		}
+		revs[e.Commit] = append(prev, revision_props{Revision: e.Revision, Properties: p})
+		recorded[e.Revision] = true
+		for name := range p {
+			names[name] = true
+		}
+	}
+	for name := range names {
+		r.Names = append(r.Names, name)
+	}
+	sort.Strings(r.Names)
+	r.Revisions = len(recorded)
+	r.Commits = len(commits)
+	if len(commits) == 0 {
+		return nil
+	}
+
+	notes := make(map[string]string, len(commits))
+	for _, commit := range commits {
+		note, err := format_revprops(revs[commit], ctx.RevpropsFormat)
+		if err != nil {
+			return err
+		}
+		notes[commit] = note
+	}
+
+	err = ctx.write_notes(ref, "Record SVN revision properties\n", commits, notes)
+	if err == nil && ctx.Verbose {
+		fmt.Printf(":: recorded the SVN revision properties of %d commits in %s\n", len(commits), ref)
+	}
+	return err
+}
+
+// EOF
@@ -0,0 +1,115 @@
+package svn
+
+import (
+	"testing"
+)
+
+func TestFormatRevprops(t *testing.T) {
+	revs := []revision_props{
+		{Revision: 5, Properties: map[string]string{"bugtraq:id": "12", "review": "line 1\nline 2\n"}},
+		{Revision: 7, Properties: map[string]string{"build": "42"}},
+	}
+	for _, tc := range []struct {
+		format string
+		revs   []revision_props
+		want   string
+	}{
+		{
+			format: RevpropsText,
+			revs:   revs[:1],
+			want:   "bugtraq:id: 12\nreview: line 1\n line 2\n",
+		},
+		{
+			format: RevpropsText,
+			revs:   revs,
+			want:   "bugtraq:id: 12\nreview: line 1\n line 2\n\nbuild: 42\n",
+		},
+		{
+			format: RevpropsJSON,
+			revs:   revs,
+			want: `[
+  {
+    "revision": 5,
+    "properties": {
+      "bugtraq:id": "12",
+      "review": "line 1\nline 2\n"
+    }
+  },
+  {
+    "revision": 7,
+    "properties": {
+      "build": "42"
+    }
+  }
+]
+`,
+		},
+	} {
+		got, err := format_revprops(tc.revs, tc.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("%s:\ngot:\n%s\nwant:\n%s", tc.format, got, tc.want)
+		}
+	}
+}
+
+func TestRecordRevprops(t *testing.T) {
+	ctx := new_test_repo(t)
+	fake_svn(t, `
+case "$*" in
+*"log --xml -q --with-all-revprops -r 1:HEAD http://svn.example.com/repo@HEAD")
+	cat <<EOF
+<log>
+<logentry revision="5"><revprops><property name="svn:log">x</property><property name="bugtraq:id">12</property></revprops></logentry>
+<logentry revision="6"><revprops><property name="svn:log">y</property></revprops></logentry>
+<logentry revision="7"><revprops><property name="build">42</property></revprops></logentry>
+<logentry revision="9"><revprops><property name="build">43</property></revprops></logentry>
+</log>
+EOF
+	;;
+*) echo "unexpected: $*" >&2; exit 1;;
+esac
+`)
+	c1 := commit_file(t, "a.txt", "a\n", "r5")
+	c2 := commit_file(t, "a.txt", "b\n", "r9")
+	// r6 and r7 were pruned into the commit of r5
+	for _, e := range []rev_entry{
+		{Rev: 9, Ref: "svn/trunk", Commit: c2},
+		{Rev: 7, Ref: "svn/tags/1.0", Commit: c1},
+		{Rev: 6, Ref: "svn/trunk", Commit: c1},
+		{Rev: 5, Ref: "svn/trunk", Commit: c1},
+	} {
+		ctx.revs.add(e)
+	}
+	ctx.RevpropsFormat = RevpropsJSON
+
+	err := ctx.record_revprops()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[
+  {
+    "revision": 5,
+    "properties": {
+      "bugtraq:id": "12"
+    }
+  },
+  {
+    "revision": 7,
+    "properties": {
+      "build": "42"
+    }
+  }
+]`
+	if got := run_git(t, "notes", "--ref", g_revprops_ref, "show", c1); got != want {
+		t.Errorf("note of r5:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+	r := ctx.report.Revprops
+	if r.Revisions != 3 || r.Commits != 2 {
+		t.Errorf("report: got %d revision(s) and %d commit(s), want 3 and 2", r.Revisions, r.Commits)
+	}
+}
+
+// EOF
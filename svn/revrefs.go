@@ -0,0 +1,173 @@
+package svn
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// handling of the SVN revision references (e.g. "r1234") of commit messages
+const (
+	RevRefsReplace = "replace" // replace the references by abbreviated git commit SHA-1s
+	RevRefsAppend  = "append"  // append the abbreviated git commit SHA-1s to the references
+)
+
+// default regular expressions of the SVN revision references: each
+// matched group is a revision number
+var g_rev_ref_regexps = []string{
+	`\br([0-9]+)(?::r?([0-9]+))?\b`,
+	`\b[Rr]evision ([0-9]+)\b`,
+}
+
+// length of the abbreviated SHA-1s written in commit messages
+const g_rev_ref_abbrev = 10
+
+// ReportRevRefs summarizes the rewriting of SVN revision references
+type ReportRevRefs struct {
+	Rewritten  int `json:"rewritten"`  // references rewritten
+	Unresolved int `json:"unresolved"` // references to revisions without git commit, left as is
+}
+
+// rev_refs_filter is a commit filter rewriting the SVN revision references
+// of commit messages into git commit references
+type rev_refs_filter struct {
+	ctx  *Context
+	rw   *rewriter
+	res  []*regexp.Regexp
+	revs map[int][]rev_entry // SVN revision -> original git commits
+}
+
+func (ctx *Context) new_rev_refs_filter(rw *rewriter) (*rev_refs_filter, error) {
+	switch ctx.RevRefs {
+	case RevRefsReplace, RevRefsAppend:
+		// ok
+	default:
+		return nil, fmt.Errorf("invalid '-rev-refs' mode %q", ctx.RevRefs)
+	}
+
+	exprs := ctx.RevRefRegexps
+	if len(exprs) == 0 {
+		exprs = g_rev_ref_regexps
+	}
+	f := &rev_refs_filter{
+		ctx:  ctx,
+		rw:   rw,
+		res:  make([]*regexp.Regexp, 0, len(exprs)),
+		revs: make(map[int][]rev_entry),
+	}
+	for _, expr := range exprs {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid '-rev-ref-regex' %q: %v", expr, err)
+		}
+		if re.NumSubexp() == 0 {
+			return nil, fmt.Errorf("invalid '-rev-ref-regex' %q: no group matching the revision", expr)
+		}
+		f.res = append(f.res, re)
+	}
+
+	refs := make([]string, 0, len(ctx.revs.refs))
+	for ref := range ctx.revs.refs {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	for _, ref := range refs {
+		for _, e := range ctx.revs.refs[ref] {
+			f.revs[e.Rev] = append(f.revs[e.Rev], e)
+		}
+	}
+	return f, nil
+}
+
+func (f *rev_refs_filter) filter(c *fi_commit) error {
+	ref := ""
+	if e, ok := f.ctx.revs.commit(c.OrigID); ok {
+		ref = e.Ref
+	}
+	msg := c.Msg
+	for _, re := range f.res {
+		var err error = nil
+		msg = re.ReplaceAllFunc(msg, func(match []byte) []byte {
+			if err != nil {
+				return match
+			}
+			var out []byte
+			out, err = f.rewrite(re, match, ref)
+			return out
+		})
+		if err != nil {
+			return err
+		}
+	}
+	c.Msg = msg
+	return nil
+}
+
+// rewrite returns the rewrite of the reference match of re, found in a
+// commit of the git-svn ref ref
+func (f *rev_refs_filter) rewrite(re *regexp.Regexp, match []byte, ref string) ([]byte, error) {
+	groups := re.FindSubmatch(match)
+	shas := []string{}
+	for _, g := range groups[1:] {
+		if len(g) == 0 {
+			continue
+		}
+		rev, err := strconv.Atoi(string(g))
+		if err != nil {
+			f.ctx.report.RevRefs.Unresolved++
+			return match, nil
+		}
+		sha, err := f.commit(rev, ref)
+		if err != nil {
+			return nil, err
+		}
+		if sha == "" {
+			f.ctx.report.RevRefs.Unresolved++
+			return match, nil
+		}
+		shas = append(shas, sha)
+	}
+	if len(shas) == 0 {
+		return match, nil
+	}
+	f.ctx.report.RevRefs.Rewritten++
+	if f.ctx.RevRefs == RevRefsReplace {
+		return []byte(strings.Join(shas, "..")), nil
+	}
+	return []byte(string(match) + " (" + strings.Join(shas, "..") + ")"), nil
+}
+
+// commit returns the abbreviated SHA-1 of the rewritten commit of the SVN
+// revision rev, preferably on ref, then on trunk, or "" if there is none
+func (f *rev_refs_filter) commit(rev int, ref string) (string, error) {
+	entries := f.revs[rev]
+	if len(entries) == 0 {
+		return "", nil
+	}
+	e := entries[0]
+	for _, pref := range []string{"svn/trunk", ref} {
+		for _, o := range entries {
+			if o.Ref == pref {
+				e = o
+			}
+		}
+	}
+	// only the commits already rewritten can be referred to: the others
+	// were dropped, or come later in the history
+	mark := f.rw.commit_ref(e.Commit)
+	if mark == "" || mark == e.Commit {
+		return "", nil
+	}
+	sha, err := f.rw.sha(mark)
+	if err != nil {
+		return "", err
+	}
+	if len(sha) > g_rev_ref_abbrev {
+		sha = sha[:g_rev_ref_abbrev]
+	}
+	return sha, nil
+}
+
+// EOF
@@ -0,0 +1,896 @@
+package svn
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// History is rewritten by piping 'git fast-export' through a set of
+// filters into 'git fast-import', in the same repository.
+// Only local branches and tags are rewritten: the git-svn remote branches
+// keep pointing at the original history.
+
+// fi_commit is a commit of a fast-export stream
+type fi_commit struct {
+	Ref       string    // ref the commit is exported on
+	Mark      string    // mark of the commit (":N")
+	OrigID    string    // original commit SHA-1
+	Author    string    // "Name <email> when tz"
+	Committer string    // "Name <email> when tz"
+	Encoding  string    // encoding of the message ("" for UTF-8)
+	Msg       []byte    // commit message
+	From      string    // first parent (mark or SHA-1), "" for root commits
+	Merges    []string  // other parents
+	Files     []fi_file // file changes, relative to the first parent
+}
+
+// fi_file is a file change of a fast-export commit
+type fi_file struct {
+	Op   byte   // 'M', 'D', 'C', 'R', or 0 for deleteall
+	Mode string // file mode (M)
+	Data string // blob SHA-1, mark, or "inline" (M)
+	Blob []byte // content of inline data
+	Path string // path of the file
+	Dest string // destination path (C, R)
+}
+
+// fi_tag is an annotated tag of a fast-export stream
+type fi_tag struct {
+	Name   string // name of the tag (without refs/tags/)
+	From   string // tagged commit
+	OrigID string // original tag SHA-1
+	Tagger string // "Name <email> when tz"
+	Msg    []byte // tag message
+}
+
+// commit_filter modifies a commit in place. The parents of the commit
+// already point at rewritten commits.
+type commit_filter func(c *fi_commit) error
+
+// tag_filter modifies an annotated tag in place
+type tag_filter func(t *fi_tag) error
+
+// rewriter holds the filters applied by rewrite_history
+type rewriter struct {
+	commits []commit_filter
+	tags    []tag_filter
+	prune   bool // drop commits which end up without file changes
+	dry_run bool // write the rewritten history to scratch refs, only print the message changes
+
+	// sha returns the SHA-1 of a commit of the rewritten history, given
+	// its mark (set while the rewrite runs)
+	sha func(ref string) (string, error)
+
+	pruned map[string]int    // number of pruned commits, per ref
+	orig   map[string]string // original commit SHA-1 -> mark of its rewrite
+}
+
+func new_rewriter() *rewriter {
+	return &rewriter{
+		commits: []commit_filter{},
+		tags:    []tag_filter{},
+		pruned:  make(map[string]int),
+		orig:    make(map[string]string),
+	}
+}
+
+// commit_ref returns how to refer to the rewrite of the original commit sha
+// in the output stream: its mark, or sha itself if it is outside of the
+// rewritten history (or not rewritten yet). An empty string is returned if
+// the commit was dropped without replacement.
+func (rw *rewriter) commit_ref(sha string) string {
+	if mark, ok := rw.orig[sha]; ok {
+		return mark
+	}
+	return sha
+}
+
+// scratch namespace of the refs written by a dry run
+const g_dry_run_ns = "svn2git-dry-run/"
+
+// rewrite_history runs all the history rewriting steps enabled in ctx
+func (ctx *Context) rewrite_history() error {
+	rw := new_rewriter()
+	rw.dry_run = ctx.RewriteDryRun
+
+	var enc *encoding_filter
+	if ctx.LogEncoding != "" {
+		var err error
+		enc, err = ctx.new_encoding_filter()
+		if err != nil {
+			return err
+		}
+		rw.commits = append(rw.commits, enc.filter)
+		rw.tags = append(rw.tags, enc.filter_tag)
+	}
+
+	if ctx.MessageCleanup || len(ctx.MessageRules) > 0 || ctx.MessageFilter != "" {
+		mf, err := ctx.new_message_filter()
+		if err != nil {
+			return err
+		}
+		rw.commits = append(rw.commits, mf.filter)
+		rw.tags = append(rw.tags, mf.filter_tag)
+	}
+
+	if ctx.RevRefs != "" {
+		rf, err := ctx.new_rev_refs_filter(rw)
+		if err != nil {
+			return err
+		}
+		rw.commits = append(rw.commits, rf.filter)
+	}
+
+	if ctx.SvnId == SvnIdStrip || ctx.SvnId == SvnIdTrailer {
+		rw.commits = append(rw.commits, ctx.new_svn_id_filter().filter)
+	}
+
+	if ctx.Committer != "" || ctx.CommitterDate != CommitterDateSvn {
+		cf, err := ctx.new_committer_filter()
+		if err != nil {
+			return err
+		}
+		rw.commits = append(rw.commits, cf.filter)
+		rw.tags = append(rw.tags, cf.filter_tag)
+	}
+
+	if ctx.Mergeinfo {
+		mf, err := ctx.new_merge_filter(rw)
+		if err != nil {
+			return err
+		}
+		rw.commits = append(rw.commits, mf.filter)
+	}
+
+	if len(ctx.PathRules) > 0 {
+		pf, err := ctx.new_path_filter()
+		if err != nil {
+			return err
+		}
+		rw.commits = append(rw.commits, pf.filter)
+	}
+
+	if ctx.LfsThreshold > 0 || len(ctx.LfsPatterns) > 0 {
+		lfs, err := ctx.new_lfs_filter()
+		if err != nil {
+			return err
+		}
+		defer lfs.close()
+		rw.commits = append(rw.commits, lfs.filter)
+	}
+
+	rw.prune = ctx.PruneEmpty
+
+	if len(rw.commits) == 0 && len(rw.tags) == 0 && !rw.prune {
+		return nil
+	}
+	err := ctx.run_rewriter(rw)
+	if err == nil && enc != nil {
+		enc.report()
+	}
+	if err != nil || rw.dry_run {
+		return err
+	}
+
+	for ref, n := range rw.pruned {
+		if ctx.Verbose {
+			fmt.Printf(":: pruned %d empty commit(s) from [%s]\n", n, ref)
+		}
+		ctx.report.Pruned[ref] += n
+	}
+	return err
+}
+
+// has_rewrites returns whether some options need the history to be rewritten
+func (ctx *Context) has_rewrites() bool {
+	return ctx.Mergeinfo || ctx.PruneEmpty || ctx.RevRefs != "" || ctx.LogEncoding != "" ||
+		ctx.MessageCleanup || len(ctx.MessageRules) > 0 || ctx.MessageFilter != "" ||
+		ctx.SvnId == SvnIdStrip || ctx.SvnId == SvnIdTrailer ||
+		ctx.Committer != "" || ctx.CommitterDate != CommitterDateSvn ||
+		ctx.LfsThreshold > 0 || len(ctx.LfsPatterns) > 0 || len(ctx.PathRules) > 0
+}
+
+// run_rewriter rewrites the local branches and tags through the filters of rw
+func (ctx *Context) run_rewriter(rw *rewriter) error {
+	var err error = nil
+
+	tmp, err := ioutil.TempDir("", "go-svn2git-rewrite-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	marks := filepath.Join(tmp, "marks")
+
+	exp := exec.Command("git", "fast-export",
+		"--no-data", "--show-original-ids", "--reencode=no",
+		"--signed-tags=strip", "--tag-of-filtered-object=rewrite",
+		"--use-done-feature", "--date-order",
+		"--branches", "--tags",
+	)
+	if ctx.ArchiveDeleted {
+		exp.Args = append(exp.Args, "--glob="+ctx.archive_namespace()+"*")
+	}
+	imp := exec.Command("git", "fast-import",
+		"--force", "--quiet", "--export-marks="+marks,
+		"--cat-blob-fd=3",
+	)
+	ctx.print_cmd(exp)
+	ctx.print_cmd(imp)
+	exp.Stderr = os.Stderr
+	imp.Stderr = os.Stderr
+	if ctx.Verbose {
+		imp.Stdout = os.Stdout
+	}
+
+	r, err := exp.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	w, err := imp.StdinPipe()
+	if err != nil {
+		return err
+	}
+	// fast-import answers get-mark commands on its cat-blob file descriptor
+	answers, pw, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer answers.Close()
+	imp.ExtraFiles = []*os.File{pw}
+	err = exp.Start()
+	if err != nil {
+		pw.Close()
+		return err
+	}
+	err = imp.Start()
+	pw.Close()
+	if err != nil {
+		exp.Process.Kill()
+		exp.Wait()
+		return err
+	}
+
+	st := &rewrite_state{
+		ctx:     ctx,
+		rw:      rw,
+		r:       bufio.NewReader(r),
+		w:       bufio.NewWriter(w),
+		alias:   make(map[string]string),
+		last:    make(map[string]string),
+		dropped: make(map[string]bool),
+		answers: bufio.NewReader(answers),
+		shas:    make(map[string]string),
+	}
+	rw.sha = st.sha
+	err = st.run()
+	if err != nil {
+		// unblock and stop both ends
+		w.Close()
+		exp.Process.Kill()
+		exp.Wait()
+		imp.Wait()
+		return err
+	}
+	err = st.w.Flush()
+	if err == nil {
+		err = w.Close()
+	}
+	if err1 := exp.Wait(); err == nil && err1 != nil {
+		err = fmt.Errorf("git fast-export: %v", err1)
+	}
+	if err1 := imp.Wait(); err == nil && err1 != nil {
+		err = fmt.Errorf("git fast-import: %v", err1)
+	}
+	if err != nil {
+		return err
+	}
+
+	if rw.dry_run {
+		return ctx.delete_dry_run_refs()
+	}
+
+	// refs whose commits were all dropped
+	for _, ref := range st.deleted {
+		cmd := exec.Command("git", "update-ref", "-d", ref)
+		ctx.print_cmd(cmd)
+		err = cmd.Run()
+		if err != nil {
+			return err
+		}
+		ctx.warn(fmt.Sprintf("%s: all commits were dropped, ref deleted", ref))
+	}
+
+	mapping, err := st.mapping(marks)
+	if err != nil {
+		return err
+	}
+	ctx.revs.rewrite(mapping)
+
+	for _, ref := range st.refs() {
+		if strings.HasPrefix(ref, "refs/heads/") {
+			err = ctx.refresh_worktree(ref[len("refs/heads/"):])
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return err
+}
+
+// rewrite_state is the state of a running rewrite
+type rewrite_state struct {
+	ctx *Context
+	rw  *rewriter
+	r   *bufio.Reader
+	w   *bufio.Writer
+
+	answers *bufio.Reader     // answers of fast-import to get-mark commands
+	shas    map[string]string // mark -> SHA-1, of the commits already asked for
+	alias   map[string]string // dropped commit -> replacement ("" for none)
+	last    map[string]string // ref -> last commit written (or aliased) on it
+	dropped map[string]bool   // refs whose last commit was dropped
+	deleted []string          // refs to delete once the import is done
+	line    string            // current line, already read
+}
+
+// run copies the fast-export stream to fast-import, through the filters
+func (st *rewrite_state) run() error {
+	var err error = nil
+	for {
+		if st.line == "" {
+			st.line, err = st.read_line()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+		line := st.line
+		st.line = ""
+		switch {
+		case line == "":
+			// blank separator
+		case strings.HasPrefix(line, "commit "):
+			err = st.commit(line[len("commit "):])
+		case strings.HasPrefix(line, "tag "):
+			err = st.tag(line[len("tag "):])
+		case strings.HasPrefix(line, "reset "):
+			err = st.reset(line[len("reset "):])
+		case line == "done":
+			return st.finish()
+		case strings.HasPrefix(line, "feature "), strings.HasPrefix(line, "progress "):
+			_, err = fmt.Fprintf(st.w, "%s\n", line)
+		default:
+			err = fmt.Errorf("rewrite: unexpected fast-export command %q", line)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (st *rewrite_state) read_line() (string, error) {
+	line, err := st.r.ReadString('\n')
+	if err != nil {
+		if err == io.EOF && line != "" {
+			return line, nil
+		}
+		return "", err
+	}
+	return strings.TrimSuffix(line, "\n"), nil
+}
+
+func (st *rewrite_state) read_data(line string) ([]byte, error) {
+	if !strings.HasPrefix(line, "data ") {
+		return nil, fmt.Errorf("rewrite: expected data, got %q", line)
+	}
+	n, err := strconv.Atoi(line[len("data "):])
+	if err != nil {
+		return nil, fmt.Errorf("rewrite: invalid data command %q", line)
+	}
+	buf := make([]byte, n)
+	_, err = io.ReadFull(st.r, buf)
+	if err != nil {
+		return nil, err
+	}
+	// data may be followed by an optional LF
+	if next, err := st.r.Peek(1); err == nil && next[0] == '\n' {
+		st.r.ReadByte()
+	}
+	return buf, nil
+}
+
+// resolve returns the replacement of a dropped commit
+func (st *rewrite_state) resolve(ref string) string {
+	if v, ok := st.alias[ref]; ok {
+		return v
+	}
+	return ref
+}
+
+func (st *rewrite_state) commit(ref string) error {
+	c := &fi_commit{Ref: ref}
+	has_from := false
+	for {
+		line, err := st.read_line()
+		if err != nil {
+			return err
+		}
+		switch {
+		case strings.HasPrefix(line, "mark "):
+			c.Mark = line[len("mark "):]
+		case strings.HasPrefix(line, "original-oid "):
+			c.OrigID = line[len("original-oid "):]
+		case strings.HasPrefix(line, "author "):
+			c.Author = line[len("author "):]
+		case strings.HasPrefix(line, "committer "):
+			c.Committer = line[len("committer "):]
+		case strings.HasPrefix(line, "encoding "):
+			c.Encoding = line[len("encoding "):]
+		case strings.HasPrefix(line, "data "):
+			c.Msg, err = st.read_data(line)
+		case strings.HasPrefix(line, "from "):
+			c.From = line[len("from "):]
+			has_from = true
+		case strings.HasPrefix(line, "merge "):
+			c.Merges = append(c.Merges, line[len("merge "):])
+		case line == "deleteall":
+			c.Files = append(c.Files, fi_file{Op: 0})
+		case strings.HasPrefix(line, "M "), strings.HasPrefix(line, "D "),
+			strings.HasPrefix(line, "C "), strings.HasPrefix(line, "R "):
+			f, err := parse_fi_file(line)
+			if err != nil {
+				return err
+			}
+			if f.Op == 'M' && f.Data == "inline" {
+				line, err = st.read_line()
+				if err != nil {
+					return err
+				}
+				f.Blob, err = st.read_data(line)
+				if err != nil {
+					return err
+				}
+			}
+			c.Files = append(c.Files, f)
+		default:
+			// end of commit: keep the line for the next command
+			st.line = line
+			if line == "" {
+				st.line = ""
+			}
+			return st.write_commit(c, has_from)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (st *rewrite_state) write_commit(c *fi_commit, has_from bool) error {
+	var err error = nil
+
+	// without 'from', a commit follows the previous one on its ref
+	if !has_from {
+		c.From = st.last[c.Ref]
+	}
+	msg := c.Msg
+	c.From = st.resolve(c.From)
+	merges := []string{}
+	for _, m := range c.Merges {
+		m = st.resolve(m)
+		if m != "" && m != c.From && !is_in_slice(m, merges) {
+			merges = append(merges, m)
+		}
+	}
+	c.Merges = merges
+	if c.From == "" && len(c.Merges) > 0 {
+		c.From, c.Merges = c.Merges[0], c.Merges[1:]
+	}
+
+	for _, filter := range st.rw.commits {
+		err = filter(c)
+		if err != nil {
+			return err
+		}
+	}
+
+	if st.rw.prune && len(c.Files) == 0 && len(c.Merges) == 0 {
+		st.alias[c.Mark] = c.From
+		st.last[c.Ref] = c.From
+		st.dropped[c.Ref] = true
+		st.rw.pruned[c.Ref]++
+		if c.OrigID != "" {
+			st.rw.orig[c.OrigID] = c.From
+		}
+		return nil
+	}
+	st.last[c.Ref] = c.Mark
+	st.dropped[c.Ref] = false
+	if c.OrigID != "" {
+		st.rw.orig[c.OrigID] = c.Mark
+	}
+	if st.rw.dry_run && !bytes.Equal(msg, c.Msg) {
+		print_message_diff(c.OrigID, c.Ref, msg, c.Msg)
+	}
+
+	w := st.w
+	if c.From == "" {
+		fmt.Fprintf(w, "reset %s\n", st.out(c.Ref))
+	}
+	fmt.Fprintf(w, "commit %s\nmark %s\n", st.out(c.Ref), c.Mark)
+	if c.Author != "" {
+		fmt.Fprintf(w, "author %s\n", c.Author)
+	}
+	fmt.Fprintf(w, "committer %s\n", c.Committer)
+	if c.Encoding != "" {
+		fmt.Fprintf(w, "encoding %s\n", c.Encoding)
+	}
+	fmt.Fprintf(w, "data %d\n", len(c.Msg))
+	w.Write(c.Msg)
+	w.WriteString("\n")
+	if c.From != "" {
+		fmt.Fprintf(w, "from %s\n", c.From)
+	}
+	for _, m := range c.Merges {
+		fmt.Fprintf(w, "merge %s\n", m)
+	}
+	for _, f := range c.Files {
+		switch f.Op {
+		case 0:
+			fmt.Fprintf(w, "deleteall\n")
+		case 'M':
+			fmt.Fprintf(w, "M %s %s %s\n", f.Mode, f.Data, fi_quote(f.Path))
+			if f.Data == "inline" {
+				fmt.Fprintf(w, "data %d\n", len(f.Blob))
+				w.Write(f.Blob)
+				w.WriteString("\n")
+			}
+		case 'D':
+			fmt.Fprintf(w, "D %s\n", fi_quote(f.Path))
+		case 'C', 'R':
+			fmt.Fprintf(w, "%c %s %s\n", f.Op, fi_quote_always(f.Path), fi_quote(f.Dest))
+		}
+	}
+	_, err = w.WriteString("\n")
+	return err
+}
+
+func (st *rewrite_state) tag(name string) error {
+	t := &fi_tag{Name: name}
+	for {
+		line, err := st.read_line()
+		if err != nil {
+			return err
+		}
+		switch {
+		case strings.HasPrefix(line, "mark "):
+			// tags are not referenced by marks
+		case strings.HasPrefix(line, "from "):
+			t.From = line[len("from "):]
+		case strings.HasPrefix(line, "original-oid "):
+			t.OrigID = line[len("original-oid "):]
+		case strings.HasPrefix(line, "tagger "):
+			t.Tagger = line[len("tagger "):]
+		case strings.HasPrefix(line, "data "):
+			t.Msg, err = st.read_data(line)
+			if err != nil {
+				return err
+			}
+			return st.write_tag(t)
+		default:
+			return fmt.Errorf("rewrite: unexpected line %q in tag %s", line, name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (st *rewrite_state) write_tag(t *fi_tag) error {
+	var err error = nil
+	t.From = st.resolve(t.From)
+	if t.From == "" {
+		st.ctx.warn(fmt.Sprintf("tag %s: tagged commit was dropped, tag removed", t.Name))
+		st.deleted = append(st.deleted, "refs/tags/"+t.Name)
+		return nil
+	}
+	for _, filter := range st.rw.tags {
+		err = filter(t)
+		if err != nil {
+			return err
+		}
+	}
+	w := st.w
+	name := t.Name
+	if st.rw.dry_run {
+		name = g_dry_run_ns + name
+	}
+	fmt.Fprintf(w, "tag %s\nfrom %s\n", name, t.From)
+	if t.Tagger != "" {
+		fmt.Fprintf(w, "tagger %s\n", t.Tagger)
+	}
+	fmt.Fprintf(w, "data %d\n", len(t.Msg))
+	w.Write(t.Msg)
+	_, err = w.WriteString("\n")
+	return err
+}
+
+func (st *rewrite_state) reset(ref string) error {
+	line, err := st.read_line()
+	if err != nil {
+		return err
+	}
+	from := ""
+	if strings.HasPrefix(line, "from ") {
+		from = st.resolve(line[len("from "):])
+	} else {
+		st.line = line
+	}
+	st.last[ref] = from
+	st.dropped[ref] = false
+	if from == "" {
+		// the next commit on ref is a root commit: write_commit emits
+		// the reset itself
+		return nil
+	}
+	_, err = fmt.Fprintf(st.w, "reset %s\nfrom %s\n\n", st.out(ref), from)
+	return err
+}
+
+// finish points the refs whose last commits were dropped at their
+// replacement, and ends the stream
+func (st *rewrite_state) finish() error {
+	for _, ref := range st.refs() {
+		if !st.dropped[ref] {
+			continue
+		}
+		from := st.last[ref]
+		if from == "" {
+			st.deleted = append(st.deleted, ref)
+			continue
+		}
+		fmt.Fprintf(st.w, "reset %s\nfrom %s\n\n", st.out(ref), from)
+	}
+	_, err := fmt.Fprintf(st.w, "done\n")
+	return err
+}
+
+// out returns the ref written for ref: ref itself, or its scratch
+// counterpart in a dry run
+func (st *rewrite_state) out(ref string) string {
+	if !st.rw.dry_run {
+		return ref
+	}
+	if strings.HasPrefix(ref, "refs/tags/") {
+		return "refs/tags/" + g_dry_run_ns + ref[len("refs/tags/"):]
+	}
+	return "refs/" + g_dry_run_ns + strings.TrimPrefix(ref, "refs/")
+}
+
+// sha returns the SHA-1 of a commit already written, given its mark (or
+// its SHA-1)
+func (st *rewrite_state) sha(ref string) (string, error) {
+	if !strings.HasPrefix(ref, ":") {
+		return ref, nil
+	}
+	if sha, ok := st.shas[ref]; ok {
+		return sha, nil
+	}
+	_, err := fmt.Fprintf(st.w, "get-mark %s\n", ref)
+	if err != nil {
+		return "", err
+	}
+	err = st.w.Flush()
+	if err != nil {
+		return "", err
+	}
+	line, err := st.answers.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("rewrite: get-mark %s: %v", ref, err)
+	}
+	sha := strings.Trim(line, " \n")
+	st.shas[ref] = sha
+	return sha, nil
+}
+
+// delete_dry_run_refs deletes the scratch refs written by a dry run
+func (ctx *Context) delete_dry_run_refs() error {
+	for _, prefix := range []string{"refs/" + g_dry_run_ns, "refs/tags/" + g_dry_run_ns} {
+		refs, err := ctx.list_refs(prefix)
+		if err != nil {
+			return err
+		}
+		for _, ref := range refs {
+			cmd := exec.Command("git", "update-ref", "-d", prefix+ref)
+			ctx.print_cmd(cmd)
+			err = cmd.Run()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// print_message_diff prints the changes of a commit message
+func print_message_diff(commit, ref string, old, new []byte) {
+	fmt.Printf("--- %s (%s)\n", commit, ref)
+	a := strings.Split(strings.TrimRight(string(old), "\n"), "\n")
+	b := strings.Split(strings.TrimRight(string(new), "\n"), "\n")
+
+	// longest common subsequence of lines
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			fmt.Printf(" %s\n", a[i])
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			fmt.Printf("-%s\n", a[i])
+			i++
+		default:
+			fmt.Printf("+%s\n", b[j])
+			j++
+		}
+	}
+}
+
+// refs returns the refs of the stream, sorted
+func (st *rewrite_state) refs() []string {
+	refs := make([]string, 0, len(st.last))
+	for ref := range st.last {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	return refs
+}
+
+// mapping returns the original -> rewritten commit SHA-1 mapping, from the
+// marks file written by fast-import
+func (st *rewrite_state) mapping(fname string) (map[string]string, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	marks := make(map[string]string)
+	scan := bufio.NewScanner(f)
+	for scan.Scan() {
+		fields := strings.Fields(scan.Text())
+		if len(fields) == 2 {
+			marks[fields[0]] = fields[1]
+		}
+	}
+	if err = scan.Err(); err != nil {
+		return nil, err
+	}
+	mapping := make(map[string]string, len(st.rw.orig))
+	for orig, mark := range st.rw.orig {
+		switch {
+		case mark == "":
+			mapping[orig] = ""
+		case strings.HasPrefix(mark, ":"):
+			mapping[orig] = marks[mark]
+		default:
+			// commit outside of the rewritten history
+			mapping[orig] = mark
+		}
+	}
+	return mapping, nil
+}
+
+// parse_fi_file parses a M, D, C or R file change line
+func parse_fi_file(line string) (fi_file, error) {
+	f := fi_file{Op: line[0]}
+	rest := line[2:]
+	var err error
+	switch f.Op {
+	case 'M':
+		fields := strings.SplitN(rest, " ", 3)
+		if len(fields) != 3 {
+			return f, fmt.Errorf("rewrite: invalid file change %q", line)
+		}
+		f.Mode, f.Data = fields[0], fields[1]
+		f.Path, err = fi_unquote(fields[2])
+	case 'D':
+		f.Path, err = fi_unquote(rest)
+	case 'C', 'R':
+		var src string
+		if strings.HasPrefix(rest, `"`) {
+			// quoted source: find its closing quote
+			i := 1
+			for ; i < len(rest); i++ {
+				if rest[i] == '\\' {
+					i++
+					continue
+				}
+				if rest[i] == '"' {
+					break
+				}
+			}
+			if i+1 >= len(rest) {
+				return f, fmt.Errorf("rewrite: invalid file change %q", line)
+			}
+			src, rest = rest[:i+1], rest[i+2:]
+		} else {
+			i := strings.Index(rest, " ")
+			if i < 0 {
+				return f, fmt.Errorf("rewrite: invalid file change %q", line)
+			}
+			src, rest = rest[:i], rest[i+1:]
+		}
+		f.Path, err = fi_unquote(src)
+		if err == nil {
+			f.Dest, err = fi_unquote(rest)
+		}
+	}
+	if err != nil {
+		return f, fmt.Errorf("rewrite: invalid path in %q: %v", line, err)
+	}
+	return f, nil
+}
+
+// fi_unquote decodes a path, possibly C-style quoted
+func fi_unquote(path string) (string, error) {
+	if !strings.HasPrefix(path, `"`) {
+		return path, nil
+	}
+	return strconv.Unquote(path)
+}
+
+// fi_quote quotes a path for fast-import, if needed
+func fi_quote(path string) string {
+	if !strings.ContainsAny(path, "\"\\\n") {
+		return path
+	}
+	return fi_quote_always(path)
+}
+
+// fi_quote_always C-style quotes a path
+func fi_quote_always(path string) string {
+	buf := new(bytes.Buffer)
+	buf.WriteByte('"')
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; c {
+		case '"', '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case '\n':
+			buf.WriteString(`\n`)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// EOF
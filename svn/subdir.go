@@ -0,0 +1,71 @@
+package svn
+
+import (
+	"fmt"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+// subdir returns ctx.Subdir, cleaned up ("" if the whole branches are
+// converted)
+func (ctx *Context) subdir() string {
+	p := strings.Trim(path.Clean("/"+ctx.Subdir), "/")
+	if p == "." {
+		return ""
+	}
+	return p
+}
+
+// set_subdir points the fetch, branches and tags specs of the git-svn
+// remote at ctx.Subdir inside trunk, branches and tags: git-svn then only
+// fetches the revisions changing that directory, with the directory as the
+// root of the commits.
+func (ctx *Context) set_subdir(remote string) error {
+	var err error = nil
+	sub := ctx.subdir()
+	if sub == "" {
+		return err
+	}
+
+	for _, key := range []string{"fetch", "branches", "tags"} {
+		name := "svn-remote." + remote + "." + key
+		out, err := exec.Command("git", "config", "--local", "--get-all", name).Output()
+		if err != nil {
+			// no such key (e.g. -no-tags or -root-is-trunk)
+			continue
+		}
+		specs := []string{}
+		for _, spec := range strings.Split(string(out), "\n") {
+			if strings.Trim(spec, " \r") == "" {
+				continue
+			}
+			// <svn path>:<git ref>
+			i := strings.LastIndex(spec, ":refs/")
+			if i < 0 {
+				return fmt.Errorf("unexpected git-svn spec %s=%q", name, spec)
+			}
+			spec = strings.TrimLeft(strings.TrimRight(spec[:i], "/")+"/"+sub, "/") + spec[i:]
+			specs = append(specs, spec)
+		}
+
+		cmd := exec.Command("git", "config", "--local", "--unset-all", name)
+		ctx.print_cmd(cmd)
+		err = cmd.Run()
+		if err != nil {
+			return err
+		}
+		for _, spec := range specs {
+			cmd := exec.Command("git", "config", "--local", "--add", name, spec)
+			ctx.print_cmd(cmd)
+			ctx.debug_cmd(cmd)
+			err = cmd.Run()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return err
+}
+
+// EOF
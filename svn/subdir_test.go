@@ -0,0 +1,56 @@
+package svn
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestSubdir(t *testing.T) {
+	for subdir, want := range map[string]string{
+		"":           "",
+		"/":          "",
+		".":          "",
+		"lib":        "lib",
+		"/lib/x/":    "lib/x",
+		"lib/../src": "src",
+	} {
+		ctx := NewContext("http://svn.example.com/repo")
+		ctx.Subdir = subdir
+		if got := ctx.subdir(); got != want {
+			t.Errorf("subdir(%q): got %q, want %q", subdir, got, want)
+		}
+	}
+}
+
+func TestSetSubdir(t *testing.T) {
+	ctx := new_test_repo(t)
+	ctx.Subdir = "/lib/"
+	run_git(t, "config", "--local", "svn-remote.svn.url", "http://svn.example.com/repo")
+	run_git(t, "config", "--local", "--add", "svn-remote.svn.fetch", "trunk:refs/remotes/svn/trunk")
+	run_git(t, "config", "--local", "--add", "svn-remote.svn.fetch", ":refs/remotes/svn/root")
+	run_git(t, "config", "--local", "--add", "svn-remote.svn.branches", "branches/*:refs/remotes/svn/*")
+	run_git(t, "config", "--local", "--add", "svn-remote.svn.branches", "releases/*/:refs/remotes/svn/releases/*")
+
+	err := ctx.set_subdir("svn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{
+		"fetch":    "trunk/lib:refs/remotes/svn/trunk\nlib:refs/remotes/svn/root",
+		"branches": "branches/*/lib:refs/remotes/svn/*\nreleases/*/lib:refs/remotes/svn/releases/*",
+	} {
+		if got := run_git(t, "config", "--local", "--get-all", "svn-remote.svn."+key); got != want {
+			t.Errorf("%s: got %q, want %q", key, got, want)
+		}
+	}
+	if exec.Command("git", "config", "--local", "--get", "svn-remote.svn.tags").Run() == nil {
+		t.Errorf("tags: unexpected spec")
+	}
+
+	run_git(t, "config", "--local", "svn-remote.svn.tags", "tags/*")
+	if err := ctx.set_subdir("svn"); err == nil {
+		t.Errorf("spec without a ref: expected an error")
+	}
+}
+
+// EOF
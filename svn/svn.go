@@ -0,0 +1,242 @@
+package svn
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// svn_cmd runs the svn command line client and returns its standard output
+func (ctx *Context) svn_cmd(cmdargs ...string) ([]byte, error) {
+	args := []string{"--non-interactive"}
+	if ctx.UserName != "" {
+		args = append(args, fmt.Sprintf("--username=%s", ctx.UserName))
+	}
+	args = append(args, cmdargs...)
+	cmd := exec.Command("svn", args...)
+	ctx.print_cmd(cmd)
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if ctx.Verbose {
+		cmd.Stderr = os.Stderr
+	}
+	err := cmd.Run()
+	if err != nil {
+		msg := strings.Trim(stderr.String(), " \r\n")
+		if msg != "" {
+			return nil, fmt.Errorf("%s: %v (%s)", strings.Join(cmd.Args, " "), err, msg)
+		}
+		return nil, fmt.Errorf("%s: %v", strings.Join(cmd.Args, " "), err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// svn_url returns the SVN URL of a git-svn remote branch
+// (e.g. "svn/trunk", "svn/tags/1.0" or "svn/1.x"), including the -subdir
+// directory
+func (ctx *Context) svn_url(ref string) string {
+	url := ctx.svn_branch_url(ref)
+	if sub := ctx.subdir(); sub != "" {
+		url += "/" + sub
+	}
+	return url
+}
+
+// svn_branch_url returns the SVN URL of the root of a git-svn remote branch,
+// without the -subdir directory.
+// The "@REV" suffix of the previous incarnations of re-created branches
+// ("svn/1.x@123") is dropped: the URL is then only valid with a peg revision
+// up to REV.
+// The deleted branches and tags fetched by -archive-deleted
+// ("svn-archive/branches/old") are in the branches and tags directories.
+func (ctx *Context) svn_branch_url(ref string) string {
+	base := strings.TrimRight(ctx.Url, "/")
+	if rest := strings.TrimPrefix(ref, g_archive_remote_refs); rest != ref {
+		i := strings.Index(rest, "/")
+		if i > 0 {
+			dir := ctx.Branches
+			if rest[:i] == "tags" {
+				dir = ctx.Tags
+			}
+			return base + "/" + dir + "/" + rest[i+1:]
+		}
+	}
+	name := strings.TrimPrefix(ref, "svn/")
+	if m := g_recreated_re.FindStringSubmatch(ref); m != nil {
+		name = m[1]
+	}
+	url := ""
+	switch {
+	case ctx.RootIsTrunk:
+		url = base
+	case name == "trunk":
+		url = base + "/" + ctx.Trunk
+	case strings.HasPrefix(name, "tags/"):
+		url = base + "/" + ctx.Tags + "/" + name[len("tags/"):]
+	default:
+		url = base + "/" + ctx.Branches + "/" + name
+	}
+	return url
+}
+
+// svn_rel_path returns the path of a git-svn remote branch relative to the
+// repository URL (e.g. "trunk", "branches/1.x", or "/" if the root is trunk)
+func (ctx *Context) svn_rel_path(ref string) string {
+	base := strings.TrimRight(ctx.Url, "/")
+	p := strings.TrimPrefix(strings.TrimPrefix(ctx.svn_url(ref), base), "/")
+	if p == "" {
+		p = "/"
+	}
+	return p
+}
+
+// svn_ref returns the git-svn remote branch of a path relative to the
+// repository URL: the reverse of svn_rel_path
+func (ctx *Context) svn_ref(p string) string {
+	if sub := ctx.subdir(); sub != "" {
+		p = strings.TrimSuffix(strings.TrimSuffix(p, sub), "/")
+		if p == "" {
+			p = "/"
+		}
+	}
+	switch {
+	case ctx.RootIsTrunk || p == "/" || p == ctx.Trunk:
+		return "svn/trunk"
+	case ctx.Tags != "" && strings.HasPrefix(p, ctx.Tags+"/"):
+		return "svn/tags/" + p[len(ctx.Tags)+1:]
+	case ctx.Branches != "" && strings.HasPrefix(p, ctx.Branches+"/"):
+		return "svn/" + p[len(ctx.Branches)+1:]
+	}
+	return "svn/" + p
+}
+
+// commit_entry returns the revision the git commit (or ref) was converted
+// from, or that of its closest first-parent ancestor converted from SVN
+// (commits added on top of the branches by go-svn2git have no SVN revision)
+func (ctx *Context) commit_entry(revs *revmap, commit string) (rev_entry, bool) {
+	if e, ok := revs.commit(commit); ok {
+		return e, true
+	}
+	out, err := ctx.git_output("rev-list", "--first-parent", commit)
+	if err != nil {
+		return rev_entry{}, false
+	}
+	for _, sha := range strings.Fields(string(out)) {
+		if e, ok := revs.commit(sha); ok {
+			return e, true
+		}
+	}
+	return rev_entry{}, false
+}
+
+// svn_branch associates a converted git branch with its SVN counterpart
+type svn_branch struct {
+	Name string // local git branch
+	Ref  string // git-svn remote branch (e.g. "svn/trunk")
+	Rev  int    // last SVN revision of the branch
+}
+
+// svn_branches returns the local branches converted from SVN, trunk first.
+// The git-svn remote branch of each one is that of its last converted
+// commit: a local branch may be named differently from its SVN counterpart
+// (-trunk-branch, SVN tags converted into branches, archived or re-created
+// branches).
+func (ctx *Context) svn_branches() ([]svn_branch, error) {
+	names, err := ctx.list_refs("refs/heads/")
+	if err != nil {
+		return nil, err
+	}
+	// the trunk branch first: it wins over other branches pointing at trunk
+	for i, name := range names {
+		if name == ctx.TrunkBranch {
+			names = append([]string{name}, append(names[:i:i], names[i+1:]...)...)
+			break
+		}
+	}
+	branches := []svn_branch{}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		e, ok := ctx.commit_entry(ctx.revs, "refs/heads/"+name)
+		if !ok {
+			// not a SVN branch
+			continue
+		}
+		ref := e.Ref
+		entries := ctx.revs.refs[ref]
+		if e.Commit != entries[len(entries)-1].Commit || seen[ref] {
+			// points into the history of another branch
+			continue
+		}
+		seen[ref] = true
+		b := svn_branch{Name: name, Ref: ref, Rev: entries[len(entries)-1].Rev}
+		if ref == "svn/trunk" {
+			branches = append([]svn_branch{b}, branches...)
+		} else {
+			branches = append(branches, b)
+		}
+	}
+	return branches, nil
+}
+
+// svn_props maps a path (relative to the queried URL, "" for the URL
+// itself) to its versioned properties
+type svn_props map[string]map[string]string
+
+// svn_proplist returns the versioned properties of svnurl@rev and of
+// everything below it. If name is not empty, only that property is
+// retrieved. A zero rev means HEAD.
+func (ctx *Context) svn_proplist(svnurl string, rev int, name string) (svn_props, error) {
+	peg := svnurl + "@HEAD"
+	if rev > 0 {
+		peg = svnurl + "@" + strconv.Itoa(rev)
+	}
+	var out []byte
+	var err error
+	if name != "" {
+		out, err = ctx.svn_cmd("propget", "-R", "--xml", name, peg)
+	} else {
+		out, err = ctx.svn_cmd("proplist", "-R", "-v", "--xml", peg)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var doc struct {
+		Targets []struct {
+			Path  string `xml:"path,attr"`
+			Props []struct {
+				Name  string `xml:"name,attr"`
+				Value string `xml:",chardata"`
+			} `xml:"property"`
+		} `xml:"target"`
+	}
+	err = xml.Unmarshal(out, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse properties of %s: %v", peg, err)
+	}
+
+	props := make(svn_props)
+	base := strings.TrimRight(svnurl, "/")
+	for _, t := range doc.Targets {
+		path := strings.Trim(strings.TrimPrefix(t.Path, base), "/")
+		if p, err := url.PathUnescape(path); err == nil {
+			path = p
+		}
+		if props[path] == nil {
+			props[path] = make(map[string]string)
+		}
+		for _, p := range t.Props {
+			props[path][p.Name] = p.Value
+		}
+	}
+	return props, nil
+}
+
+// EOF
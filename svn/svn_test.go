@@ -0,0 +1,134 @@
+package svn
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSvnUrl(t *testing.T) {
+	ctx := NewContext("http://svn.example.com/repo/")
+	for _, tc := range []struct {
+		subdir string
+		ref    string
+		want   string
+	}{
+		{"", "svn/trunk", "http://svn.example.com/repo/trunk"},
+		{"", "svn/1.x", "http://svn.example.com/repo/branches/1.x"},
+		{"", "svn/tags/1.0", "http://svn.example.com/repo/tags/1.0"},
+		{"", "svn/1.x@123", "http://svn.example.com/repo/branches/1.x"},
+		{"", "svn/tags/1.0@45", "http://svn.example.com/repo/tags/1.0"},
+		{"lib", "svn/trunk", "http://svn.example.com/repo/trunk/lib"},
+		{"lib/", "svn/1.x", "http://svn.example.com/repo/branches/1.x/lib"},
+	} {
+		ctx.Subdir = tc.subdir
+		if got := ctx.svn_url(tc.ref); got != tc.want {
+			t.Errorf("svn_url(%q) with subdir %q: got %q, want %q", tc.ref, tc.subdir, got, tc.want)
+		}
+	}
+}
+
+func TestSvnBranchUrl(t *testing.T) {
+	ctx := NewContext("http://svn.example.com/repo")
+	ctx.Subdir = "lib"
+	for ref, want := range map[string]string{
+		"svn/trunk":    "http://svn.example.com/repo/trunk",
+		"svn/1.x@12":   "http://svn.example.com/repo/branches/1.x",
+		"svn/tags/1.0": "http://svn.example.com/repo/tags/1.0",
+
+		"svn-archive/branches/old": "http://svn.example.com/repo/branches/old",
+		"svn-archive/tags/0.9":     "http://svn.example.com/repo/tags/0.9",
+	} {
+		if got := ctx.svn_branch_url(ref); got != want {
+			t.Errorf("svn_branch_url(%q): got %q, want %q", ref, got, want)
+		}
+	}
+}
+
+func TestSvnRelPathArchived(t *testing.T) {
+	ctx := NewContext("http://svn.example.com/repo")
+	ctx.Branches = "dev/branches"
+	ctx.Tags = "releases"
+	for _, tc := range []struct {
+		subdir string
+		ref    string
+		want   string
+	}{
+		{"", "svn-archive/branches/old", "dev/branches/old"},
+		{"", "svn-archive/tags/0.9", "releases/0.9"},
+		{"lib", "svn-archive/tags/0.9", "releases/0.9/lib"},
+	} {
+		ctx.Subdir = tc.subdir
+		if got := ctx.svn_rel_path(tc.ref); got != tc.want {
+			t.Errorf("svn_rel_path(%q) with subdir %q: got %q, want %q", tc.ref, tc.subdir, got, tc.want)
+		}
+	}
+	// the reverse mapping gives the ref of the same path
+	if got := ctx.svn_url(ctx.svn_ref("dev/branches/old")); got != ctx.svn_url("svn-archive/branches/old") {
+		t.Errorf("svn_ref: got the URL %q", got)
+	}
+}
+
+func TestCommitEntry(t *testing.T) {
+	ctx := new_test_repo(t)
+	c1 := commit_file(t, "a.txt", "1\n", "r1")
+	c2 := commit_file(t, "a.txt", "2\n", "r2")
+	ctx.revs.add(rev_entry{Rev: 1, Ref: "svn/trunk", Commit: c1})
+	ctx.revs.add(rev_entry{Rev: 2, Ref: "svn/tags/1.0", Commit: c2})
+
+	// a commit added by go-svn2git on top of the branch
+	c3 := commit_file(t, ".gitignore", "*.o\n", "Convert svn:ignore")
+
+	for _, tc := range []struct {
+		commit string
+		want   int
+	}{
+		{c1, 1},
+		{c2, 2},
+		{c3, 2},
+	} {
+		e, ok := ctx.commit_entry(ctx.revs, tc.commit)
+		if !ok || e.Rev != tc.want {
+			t.Errorf("commit_entry(%s): got r%d (%v), want r%d", tc.commit, e.Rev, ok, tc.want)
+		}
+	}
+
+	run_git(t, "checkout", "-q", "--orphan", "other")
+	c4 := commit_file(t, "b.txt", "b\n", "not from svn")
+	if e, ok := ctx.commit_entry(ctx.revs, c4); ok {
+		t.Errorf("commit_entry(%s): got r%d, want none", c4, e.Rev)
+	}
+}
+
+func TestSvnBranches(t *testing.T) {
+	ctx := new_test_repo(t)
+	ctx.TrunkBranch = "master"
+	c1 := commit_file(t, "a.txt", "1\n", "r1")
+	c2 := commit_file(t, "a.txt", "2\n", "r2")
+	ctx.revs.add(rev_entry{Rev: 1, Ref: "svn/trunk", Commit: c1})
+	ctx.revs.add(rev_entry{Rev: 2, Ref: "svn/trunk", Commit: c2})
+	run_git(t, "branch", "wip", c1)  // older trunk commit
+	run_git(t, "branch", "copy", c2) // trunk tip
+	commit_file(t, ".gitignore", "*.o\n", "Convert svn:ignore")
+
+	// SVN tag 1.0, converted into a branch
+	run_git(t, "checkout", "-q", "-b", "1.0", c2)
+	ctx.revs.add(rev_entry{Rev: 3, Ref: "svn/tags/1.0", Commit: commit_file(t, "a.txt", "3\n", "r3")})
+	// previous incarnation of branch x, archived
+	run_git(t, "checkout", "-q", "-b", "archive/x@5", c2)
+	ctx.revs.add(rev_entry{Rev: 4, Ref: "svn/x@5", Commit: commit_file(t, "a.txt", "4\n", "r4")})
+
+	got, err := ctx.svn_branches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []svn_branch{
+		{Name: "master", Ref: "svn/trunk", Rev: 2},
+		{Name: "1.0", Ref: "svn/tags/1.0", Rev: 3},
+		{Name: "archive/x@5", Ref: "svn/x@5", Rev: 4},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("svn_branches:\ngot  %+v\nwant %+v", got, want)
+	}
+}
+
+// EOF
@@ -0,0 +1,100 @@
+package svn
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// handling of the git-svn-id lines of commit messages
+const (
+	SvnIdKeep    = "keep"    // keep the messages as git-svn wrote them
+	SvnIdStrip   = "strip"   // remove the git-svn-id lines
+	SvnIdTrailer = "trailer" // replace the git-svn-id lines by trailers (see SvnIdFormat)
+)
+
+// default format of the trailers of SvnIdTrailer
+const g_svn_id_format = "SVN-Revision: r{rev}\nSVN-Path: {path}"
+
+var (
+	g_svn_id_re  = regexp.MustCompile(`(?m)^git-svn-id: [^\n]*(\n|$)`)
+	g_trailer_re = regexp.MustCompile(`^[A-Za-z0-9-]+: `)
+)
+
+// svn_id_filter is a commit filter stripping or rewriting git-svn-id lines
+type svn_id_filter struct {
+	ctx    *Context
+	format string
+}
+
+func (ctx *Context) new_svn_id_filter() *svn_id_filter {
+	format := ctx.SvnIdFormat
+	if format == "" {
+		format = g_svn_id_format
+	}
+	return &svn_id_filter{
+		ctx:    ctx,
+		format: format,
+	}
+}
+
+func (f *svn_id_filter) filter(c *fi_commit) error {
+	msg := g_svn_id_re.ReplaceAll(c.Msg, nil)
+	msg = append(bytes.TrimRight(msg, "\n"), '\n')
+	if f.ctx.SvnId == SvnIdTrailer {
+		if e, ok := f.ctx.revs.commit(c.OrigID); ok {
+			msg = add_trailers(msg, f.trailers(e))
+		}
+	}
+	c.Msg = msg
+	return nil
+}
+
+// trailers returns the trailers describing the SVN revision of e
+func (f *svn_id_filter) trailers(e rev_entry) string {
+	r := strings.NewReplacer(
+		"{rev}", strconv.Itoa(e.Rev),
+		"{path}", f.ctx.svn_rel_path(e.Ref),
+		"{url}", f.ctx.svn_url(e.Ref),
+	)
+	lines := []string{}
+	for _, line := range strings.Split(r.Replace(f.format), "\n") {
+		if strings.Trim(line, " \t") != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// add_trailers appends trailers to msg: to its last paragraph if it is
+// made of trailers already, as a new paragraph otherwise
+func add_trailers(msg []byte, trailers string) []byte {
+	if trailers == "" {
+		return msg
+	}
+	body := bytes.TrimRight(msg, "\n")
+	last := body
+	if i := bytes.LastIndex(body, []byte("\n\n")); i >= 0 {
+		last = body[i+2:]
+	}
+	sep := "\n\n"
+	if i := bytes.Index(body, []byte("\n\n")); i >= 0 {
+		sep = "\n"
+		for _, line := range strings.Split(string(last), "\n") {
+			if !g_trailer_re.MatchString(line) {
+				sep = "\n\n"
+				break
+			}
+		}
+	}
+	if len(body) == 0 {
+		sep = ""
+	}
+	out := append([]byte{}, body...)
+	out = append(out, sep...)
+	out = append(out, trailers...)
+	return append(out, '\n')
+}
+
+// EOF
@@ -0,0 +1,127 @@
+package svn
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// default name of the file recording the SVN properties of each branch
+const g_svnprops_file = ".svnprops"
+
+// versioned properties git records natively (file modes, symlinks,
+// merges), which are never recorded
+var g_native_props = []string{"svn:executable", "svn:special", "svn:mergeinfo"}
+
+// ReportSvnProps summarizes the versioned properties recorded in the
+// -svnprops files
+type ReportSvnProps struct {
+	File     string   `json:"file"`     // name of the file, at the root of the branches
+	Branches []string `json:"branches"` // branches the file was added to
+	Paths    int      `json:"paths"`    // number of paths with recorded properties, over all branches
+	Names    []string `json:"names"`    // names of the properties recorded
+}
+
+// converted_props returns the names of the versioned properties converted
+// by the enabled options, which are not recorded
+func (ctx *Context) converted_props() []string {
+	names := append([]string{}, g_native_props...)
+	if ctx.GitIgnore {
+		names = append(names, "svn:ignore", "svn:global-ignores")
+	}
+	if ctx.GitAttributes {
+		names = append(names, "svn:eol-style", "svn:mime-type", "svn:keywords")
+	}
+	if ctx.Externals != "" {
+		names = append(names, "svn:externals")
+	}
+	return names
+}
+
+// record_svnprops writes, for each converted branch, a JSON file mapping
+// each path ("." for the root of the branch) to its versioned properties
+// which no other option converts, added by a final commit on top of the
+// branch.
+// The paths are those of the git tree: -exclude, -include and -path-rule
+// apply.
+func (ctx *Context) record_svnprops() error {
+	if clean_rule_path(ctx.SvnPropsFile) != ctx.SvnPropsFile || ctx.SvnPropsFile == "" {
+		return fmt.Errorf("invalid '-svnprops-file' %q (want a path relative to the root of the branches)", ctx.SvnPropsFile)
+	}
+	branches, err := ctx.svn_branches()
+	if err != nil {
+		return err
+	}
+	converted, err := ctx.path_converted()
+	if err != nil {
+		return err
+	}
+	pm, err := new_path_mapper(ctx.PathRules)
+	if err != nil {
+		return err
+	}
+	skip := ctx.converted_props()
+
+	r := &ctx.report.SvnProps
+	r.File = ctx.SvnPropsFile
+	names := make(map[string]bool)
+	for _, b := range branches {
+		props, err := ctx.svn_proplist(ctx.svn_url(b.Ref), b.Rev, "")
+		if err != nil {
+			return err
+		}
+
+		recorded := make(map[string]map[string]string)
+		for path, values := range props {
+			if path != "" && !converted(path) {
+				continue
+			}
+			for name, value := range values {
+				if is_in_slice(name, skip) {
+					continue
+				}
+				key := pm.apply(path)
+				if key == "" {
+					key = "."
+				}
+				if recorded[key] == nil {
+					recorded[key] = make(map[string]string)
+				}
+				recorded[key][name] = value
+				names[name] = true
+			}
+		}
+		if len(recorded) == 0 {
+			continue
+		}
+
+		// encoding/json sorts the keys: the file is stable across runs
+		content, err := json.MarshalIndent(recorded, "", "  ")
+		if err != nil {
+			return err
+		}
+		content = append(content, '\n')
+
+		ok, err := ctx.commit_files(b.Name,
+			map[string]tree_file{
+				ctx.SvnPropsFile: {Mode: "100644", Content: content},
+			},
+			fmt.Sprintf("Record SVN properties in %s\n", ctx.SvnPropsFile),
+		)
+		if err != nil {
+			return err
+		}
+		r.Branches = append(r.Branches, b.Name)
+		r.Paths += len(recorded)
+		if ok && ctx.Verbose {
+			fmt.Printf(":: recorded the SVN properties of %d path(s) in %s of [%s]\n", len(recorded), ctx.SvnPropsFile, b.Name)
+		}
+	}
+	for name := range names {
+		r.Names = append(r.Names, name)
+	}
+	sort.Strings(r.Names)
+	return err
+}
+
+// EOF
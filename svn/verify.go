@@ -0,0 +1,385 @@
+package svn
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// files go-svn2git may add to the converted branches, which have no
+// SVN counterpart
+var g_generated_files = []string{
+	".gitignore",
+	".gitattributes",
+	".gitmodules",
+	g_externals_manifest,
+}
+
+// verify_target is a git commit checked against a SVN tree
+type verify_target struct {
+	Name   string // name used in messages (e.g. "branch 1.x")
+	Commit string // git commit
+	Ref    string // git-svn remote branch (e.g. "svn/trunk")
+	Rev    int    // SVN revision (0 means HEAD)
+}
+
+// tree_entry describes a file of a git or SVN tree
+type tree_entry struct {
+	Mode string // git file mode (100644, 100755 or 120000)
+	Blob string // git blob SHA-1 of the content (or of the symlink target)
+}
+
+// Verify compares the converted git repository in the current directory
+// with the SVN repository ctx.Url: the trees of trunk, of each branch and
+// of each tag are exported from SVN and compared file by file (content,
+// executable bit and symlinks) with the corresponding git trees.
+// If ctx.VerifyRevisions is non-zero, that many historical revisions of
+// trunk are compared as well.
+// Branches and tags whose commits are not found in the SVN revision
+// mapping are skipped. An error is returned if any difference was found,
+// if a tree could not be compared, or if nothing or not everything could
+// be compared: after a history rewrite, the mapping must come from
+// -revmap files or refs/notes/svn, as git-svn metadata still lists the
+// commits from before the rewrite.
+func (ctx *Context) Verify() error {
+	var err error = nil
+
+	revs, err := ctx.lookup_revmap()
+	if err != nil {
+		return err
+	}
+
+	// the SVN tree of each branch and tag is that of the revision its
+	// commit was converted from: a git branch may come from a SVN tag, an
+	// archived or re-created branch, and a tag from its copy source.
+	targets := []verify_target{}
+	skipped := 0
+	add := func(name, gitref string) {
+		out, err := ctx.git_output("rev-parse", "--verify", "-q", gitref+"^{commit}")
+		if err != nil {
+			fmt.Printf("** skipped %s: no git commit for %s\n", name, gitref)
+			skipped++
+			return
+		}
+		commit := strings.Trim(string(out), " \r\n")
+		e, ok := ctx.commit_entry(revs, commit)
+		if !ok {
+			fmt.Printf("** skipped %s: not converted from SVN\n", name)
+			skipped++
+			return
+		}
+		targets = append(targets, verify_target{
+			Name:   name,
+			Commit: commit,
+			Ref:    e.Ref,
+			Rev:    e.Rev,
+		})
+	}
+
+	branches, err := ctx.list_refs("refs/heads/")
+	if err != nil {
+		return err
+	}
+	if is_in_slice(ctx.TrunkBranch, branches) {
+		add("trunk", "refs/heads/"+ctx.TrunkBranch)
+	}
+	for _, branch := range branches {
+		if branch != ctx.TrunkBranch {
+			add("branch "+branch, "refs/heads/"+branch)
+		}
+	}
+
+	tags, err := ctx.list_refs("refs/tags/")
+	if err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		add("tag "+tag, "refs/tags/"+tag)
+	}
+
+	if ctx.VerifyRevisions > 0 {
+		// evenly spread samples over the history of trunk
+		entries := revs.refs["svn/trunk"]
+		n := ctx.VerifyRevisions
+		if n > len(entries) {
+			n = len(entries)
+		}
+		for i := 0; i < n; i++ {
+			e := entries[i*len(entries)/n]
+			targets = append(targets, verify_target{
+				Name:   fmt.Sprintf("trunk@r%d", e.Rev),
+				Commit: e.Commit,
+				Ref:    e.Ref,
+				Rev:    e.Rev,
+			})
+		}
+	}
+
+	ndiffs, nfailed := 0, 0
+	for _, t := range targets {
+		n, err := ctx.verify_target(t)
+		if err != nil {
+			fmt.Printf("** [%s] could not be verified: %v\n", t.Name, err)
+			nfailed++
+			continue
+		}
+		ndiffs += n
+	}
+
+	if ndiffs > 0 || nfailed > 0 {
+		return fmt.Errorf("verify: %d difference(s) found, %d tree(s) could not be verified", ndiffs, nfailed)
+	}
+	if skipped > 0 || len(targets) == 0 {
+		return fmt.Errorf("verify: %d tree(s) verified, %d branch(es) and tag(s) skipped: "+
+			"no SVN revision mapping for their commits (use -revmap or refs/notes/svn after a history rewrite)",
+			len(targets), skipped)
+	}
+	fmt.Printf(":: verified %d tree(s): no difference found\n", len(targets))
+	return err
+}
+
+// verify_target compares one git commit with its SVN tree and returns the
+// number of differences.
+// The SVN paths are moved by the path rules before the comparison.
+func (ctx *Context) verify_target(t verify_target) (int, error) {
+	converted, err := ctx.path_converted()
+	if err != nil {
+		return 0, err
+	}
+	pm, err := new_path_mapper(ctx.PathRules)
+	if err != nil {
+		return 0, err
+	}
+	excluded := func(path string) bool {
+		return !converted(path)
+	}
+	generated := func(path string) bool {
+		if ctx.SvnProps && path == ctx.SvnPropsFile {
+			return true
+		}
+		return is_in_slice(filepath.Base(path), g_generated_files)
+	}
+
+	rev := "HEAD"
+	if t.Rev > 0 {
+		rev = strconv.Itoa(t.Rev)
+	}
+	url := ctx.svn_url(t.Ref)
+	fmt.Printf(":: verifying %s against %s@%s...\n", t.Name, url, rev)
+
+	gtree, err := ctx.git_tree(t.Commit)
+	if err != nil {
+		return 0, err
+	}
+
+	tmp, err := ioutil.TempDir("", "go-svn2git-verify-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(tmp)
+	dir := filepath.Join(tmp, "export")
+
+	// keywords are stored unexpanded in git, and git-svn stores
+	// 'native' end-of-lines as LF.
+	_, err = ctx.svn_cmd("export", "-q", "--force",
+		"--ignore-externals", "--ignore-keywords", "--native-eol", "LF",
+		url+"@"+rev, dir,
+	)
+	if err != nil {
+		return 0, err
+	}
+	stree, err := svn_export_tree(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	// the vendored externals are in the git tree only
+	vendored := []string{}
+	if ctx.Externals == ExternalsVendor {
+		externals, err := ctx.svn_externals(url, t.Rev)
+		if err != nil {
+			return 0, err
+		}
+		for _, ext := range externals {
+			vendored = append(vendored, pm.apply(ext.Path))
+		}
+	}
+	is_vendored := func(path string) bool {
+		for _, dir := range vendored {
+			if is_under(path, dir) {
+				return true
+			}
+		}
+		return false
+	}
+
+	svnpaths := make(map[string]string, len(stree)) // git path -> svn path
+	for path := range stree {
+		if !excluded(path) {
+			svnpaths[pm.apply(path)] = path
+		}
+	}
+
+	diffs := []string{}
+	for np, path := range svnpaths {
+		s := stree[path]
+		g, ok := gtree[np]
+		name := np
+		if np != path {
+			name += " (svn: " + path + ")"
+		}
+		switch {
+		case generated(np):
+			// possibly amended by go-svn2git
+		case !ok:
+			diffs = append(diffs, "missing from git: "+name)
+		case g.Mode != s.Mode:
+			diffs = append(diffs, fmt.Sprintf("mode differs (git=%s svn=%s): %s", g.Mode, s.Mode, name))
+		case g.Blob != s.Blob && !same_eol_content(filepath.Join(dir, path), g.Blob) &&
+			!ctx.same_lfs_content(filepath.Join(dir, path), g.Blob):
+			diffs = append(diffs, "content differs: "+name)
+		}
+	}
+	for np := range gtree {
+		if _, ok := svnpaths[np]; ok || generated(np) || is_vendored(np) {
+			continue
+		}
+		// files of excluded SVN paths are not compared
+		srcs := pm.sources(np)
+		ignored := len(srcs) > 0
+		for _, path := range srcs {
+			ignored = ignored && excluded(path)
+		}
+		if !ignored {
+			diffs = append(diffs, "missing from svn: "+np)
+		}
+	}
+
+	sort.Strings(diffs)
+	for _, diff := range diffs {
+		fmt.Printf("** [%s] %s\n", t.Name, diff)
+	}
+	return len(diffs), nil
+}
+
+// git_tree returns the files of a git commit, indexed by path
+func (ctx *Context) git_tree(commit string) (map[string]tree_entry, error) {
+	out, err := ctx.git_output("ls-tree", "-r", "-z", "--full-tree", commit)
+	if err != nil {
+		return nil, err
+	}
+	tree := make(map[string]tree_entry)
+	for _, rec := range bytes.Split(out, []byte{0}) {
+		// <mode> SP <type> SP <object> TAB <path>
+		tab := bytes.IndexByte(rec, '\t')
+		if tab < 0 {
+			continue
+		}
+		fields := strings.Fields(string(rec[:tab]))
+		if len(fields) != 3 || fields[1] != "blob" {
+			// submodules have no SVN counterpart
+			continue
+		}
+		tree[string(rec[tab+1:])] = tree_entry{Mode: fields[0], Blob: fields[2]}
+	}
+	return tree, nil
+}
+
+// svn_export_tree returns the files of an exported SVN tree, indexed by path
+func svn_export_tree(dir string) (map[string]tree_entry, error) {
+	tree := make(map[string]tree_entry)
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		var e tree_entry
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			e = tree_entry{Mode: "120000", Blob: git_blob_sha1([]byte(target))}
+		default:
+			buf, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			e = tree_entry{Mode: "100644", Blob: git_blob_sha1(buf)}
+			if fi.Mode()&0111 != 0 {
+				e.Mode = "100755"
+			}
+		}
+		tree[filepath.ToSlash(rel)] = e
+		return nil
+	})
+	return tree, err
+}
+
+// same_eol_content returns whether the file at path matches the git blob
+// once its CRLF end-of-lines are converted to LF.
+// This accounts for files with a fixed (non-native) svn:eol-style, which
+// svn exports with their declared end-of-lines.
+func same_eol_content(path string, blob string) bool {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil || !bytes.Contains(buf, []byte("\r")) {
+		return false
+	}
+	buf = bytes.Replace(buf, []byte("\r\n"), []byte("\n"), -1)
+	return git_blob_sha1(buf) == blob
+}
+
+// same_lfs_content returns whether the git blob is the Git LFS pointer of
+// the file at path
+func (ctx *Context) same_lfs_content(path string, blob string) bool {
+	out, err := ctx.git_output("cat-file", "-s", blob)
+	if err != nil {
+		return false
+	}
+	// pointer files are about 130 bytes long
+	if n, err := strconv.Atoi(strings.Trim(string(out), " \r\n")); err != nil || n > 1024 {
+		return false
+	}
+	content, err := ctx.git_output("cat-file", "blob", blob)
+	if err != nil {
+		return false
+	}
+	oid, size, ok := parse_lfs_pointer(content)
+	if !ok {
+		return false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	return err == nil && n == size && hex.EncodeToString(h.Sum(nil)) == oid
+}
+
+// git_blob_sha1 returns the git object name of a blob with the given content
+func git_blob_sha1(content []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(content))
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// EOF
@@ -0,0 +1,147 @@
+package svn
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestVerifyTargetPathRules(t *testing.T) {
+	ctx := new_test_repo(t)
+	// SVN tree of trunk@3
+	fake_svn(t, `
+for dir; do :; done
+case "$*" in
+*"export -q --force --ignore-externals --ignore-keywords --native-eol LF http://svn.example.com/repo/trunk@3 "*)
+	mkdir -p "$dir/src/main" "$dir/doc" "$dir/junk"
+	echo a >"$dir/src/a.c"
+	echo x >"$dir/src/main/x.c"
+	echo doc >"$dir/doc/index.txt"
+	echo tmp >"$dir/junk/tmp"
+	;;
+*) echo "unexpected: $*" >&2; exit 1;;
+esac
+`)
+	ctx.PathRules = []string{"src=lib", "src/main=main"}
+	ctx.Excludes = []string{"junk"}
+	commit_file(t, "lib/a.c", "a\n", "r1")
+	commit_file(t, "main/x.c", "x\n", "r2")
+	commit_file(t, "doc/index.txt", "doc\n", "r3")
+	commit_file(t, ".gitignore", "*.o\n", "ignores")
+	target := verify_target{Name: "trunk", Ref: "svn/trunk", Rev: 3, Commit: "HEAD"}
+
+	n, err := ctx.verify_target(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("got %d difference(s), want 0", n)
+	}
+
+	// without the rules, the moved files differ
+	ctx.PathRules = nil
+	n, err = ctx.verify_target(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Fatalf("without path rules: got %d difference(s), want 4", n)
+	}
+
+	// a git file without SVN counterpart
+	ctx.PathRules = []string{"src=lib", "src/main=main"}
+	commit_file(t, "lib/b.c", "b\n", "r4")
+	n, err = ctx.verify_target(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("extra git file: got %d difference(s), want 1", n)
+	}
+}
+
+func TestVerifySkipped(t *testing.T) {
+	ctx := new_test_repo(t)
+	fake_svn(t, `echo "unexpected: $*" >&2; exit 1`)
+	commit_file(t, "a.txt", "a\n", "rewritten")
+	run_git(t, "tag", "v1")
+
+	// no SVN revision mapping: everything is skipped
+	err := ctx.Verify()
+	if err == nil || !strings.Contains(err.Error(), "2 branch(es) and tag(s) skipped") {
+		t.Fatalf("got %v, want an error for the skipped refs", err)
+	}
+
+	// an empty repository
+	run_git(t, "tag", "-d", "v1")
+	run_git(t, "update-ref", "-d", "refs/heads/master")
+	err = ctx.Verify()
+	if err == nil || !strings.Contains(err.Error(), "0 tree(s) verified") {
+		t.Fatalf("got %v, want an error for an empty repository", err)
+	}
+}
+
+func TestVerifyTargetLfs(t *testing.T) {
+	ctx := new_test_repo(t)
+	fake_svn(t, `
+for dir; do :; done
+mkdir -p "$dir"
+printf 'large content\n' >"$dir/a.bin"
+printf 'other content\n' >"$dir/b.bin"
+`)
+	pointer := func(content string) string {
+		return fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%x\nsize %d\n",
+			sha256.Sum256([]byte(content)), len(content))
+	}
+	commit_file(t, "a.bin", pointer("large content\n"), "r1")
+	commit_file(t, "b.bin", pointer("changed content\n"), "r2")
+
+	n, err := ctx.verify_target(verify_target{Name: "trunk", Ref: "svn/trunk", Commit: "HEAD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("got %d difference(s), want 1 (b.bin)", n)
+	}
+}
+
+func TestVerifyTargetVendored(t *testing.T) {
+	ctx := new_test_repo(t)
+	fake_svn(t, `
+root=http://svn.example.com/repo
+for dir; do :; done
+case "$*" in
+*"export "*)
+	mkdir -p "$dir/src"
+	echo a >"$dir/src/a.c"
+	;;
+*"propget -R --xml svn:externals $root/trunk@4")
+	echo '<properties><target path="'$root'/trunk/src"><property name="svn:externals">^/lib/zlib@3 zlib</property></target></properties>';;
+*"info --show-item repos-root-url $root/trunk") echo $root;;
+*) echo "unexpected: $*" >&2; exit 1;;
+esac
+`)
+	commit_file(t, "src/a.c", "a\n", "r4")
+	commit_file(t, "src/zlib/zlib.h", "zlib\n", "Vendor svn:externals snapshot")
+	target := verify_target{Name: "trunk", Ref: "svn/trunk", Rev: 4, Commit: "HEAD"}
+
+	n, err := ctx.verify_target(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("without -externals vendor: got %d difference(s), want 1", n)
+	}
+
+	ctx.Externals = ExternalsVendor
+	n, err = ctx.verify_target(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("got %d difference(s), want 0", n)
+	}
+}
+
+// EOF